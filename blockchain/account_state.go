@@ -0,0 +1,268 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+// Account is the state of an address after the last block of the chain.
+// Nonce counts the successful transactions the address has sent.
+type Account struct {
+	Balance uint64 `json:"balance"`
+	Nonce   uint64 `json:"nonce"`
+}
+
+// InsufficientBalanceError is returned when a transaction spends more than
+// its sender can.
+type InsufficientBalanceError struct {
+	Address  string
+	Balance  uint64
+	Required uint64
+}
+
+func (e *InsufficientBalanceError) Error() string {
+	return fmt.Sprintf("insufficient balance: %s has %d spendable, transaction needs %d", e.Address, e.Balance, e.Required)
+}
+
+// NonceError is returned when a transaction does not carry the next nonce
+// of its sender.
+type NonceError struct {
+	Address  string
+	Expected uint64
+	Got      uint64
+}
+
+func (e *NonceError) Error() string {
+	if e.Got < e.Expected {
+		return fmt.Sprintf("nonce too low: %s expects nonce %d, got %d", e.Address, e.Expected, e.Got)
+	}
+	return fmt.Sprintf("nonce too high: %s expects nonce %d, got %d", e.Address, e.Expected, e.Got)
+}
+
+func accountKey(address string) []byte {
+	return []byte(constants.ACCOUNT_PREFIX + address)
+}
+
+// GetAccount reads the state of address. Addresses the chain has never
+// seen have an empty account.
+func GetAccount(store ChainStore, address string) (*Account, error) {
+	data, err := store.Get(accountKey(address))
+	if err == ErrNotFound {
+		return &Account{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var account Account
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (bc *BlockchainStruct) GetAccount(address string) (*Account, error) {
+	return GetAccount(bc.Store, address)
+}
+
+// accountState is a view of the account table that keeps its changes in
+// memory. With rebuild set it ignores the stored accounts and starts every
+// address from zero. With clamp set a sender who spends more than they have
+// is left at zero instead of failing, since blocks from before balances
+// were checked may do that; what such a transaction did take is kept in
+// debits, by transaction hash, so it can be undone exactly.
+type accountState struct {
+	store    ChainStore
+	rebuild  bool
+	clamp    bool
+	accounts map[string]*Account
+	debits   map[string]uint64
+}
+
+func newAccountState(store ChainStore) *accountState {
+	return &accountState{
+		store:    store,
+		accounts: map[string]*Account{},
+		debits:   map[string]uint64{},
+	}
+}
+
+func clampedDebitKey(hash string) []byte {
+	return []byte(constants.CLAMPED_DEBIT_PREFIX + hash)
+}
+
+// debit returns what txn took from its sender when it was clamped, and
+// whether it was.
+func (s *accountState) debit(txn *Transaction) (uint64, bool, error) {
+	hash := txn.Hash()
+	if debit, ok := s.debits[hash]; ok {
+		return debit, true, nil
+	}
+	if s.rebuild {
+		return 0, false, nil
+	}
+
+	data, err := s.store.Get(clampedDebitKey(hash))
+	if err == ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	debit, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return debit, true, nil
+}
+
+// transfer is the part of paid, what the sender of txn paid for it, that
+// reaches the receiver: the value, or all of paid when the sender was
+// clamped to less than that.
+func transfer(txn *Transaction, paid uint64) uint64 {
+	if paid < txn.Value {
+		return paid
+	}
+	return txn.Value
+}
+
+func (s *accountState) get(address string) (*Account, error) {
+	if account, ok := s.accounts[address]; ok {
+		return account, nil
+	}
+
+	account := &Account{}
+	if !s.rebuild {
+		var err error
+		account, err = GetAccount(s.store, address)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.accounts[address] = account
+	return account, nil
+}
+
+// applyTxn moves the value of a successful transaction from its sender to
+// its receiver. The sender also pays the fee, which reaches the miner
+// through the reward. Rewards are minted by the faucet, which has no account.
+// A sender who cannot cover the transaction fails it with an
+// InsufficientBalanceError, unless s clamps; then the sender pays what they
+// have and the receiver gets no more than that.
+func (s *accountState) applyTxn(txn *Transaction) error {
+	if txn.Status != constants.SUCCESS {
+		return nil
+	}
+
+	value := txn.Value
+	if txn.From != constants.BLOCKCHAIN_ADDRESS {
+		sender, err := s.get(txn.From)
+		if err != nil {
+			return err
+		}
+		cost := txn.Cost()
+		if sender.Balance < cost {
+			if !s.clamp {
+				return &InsufficientBalanceError{Address: txn.From, Balance: sender.Balance, Required: cost}
+			}
+			log.Printf("Transaction %s overdraws %s by %d, leaving the balance at zero", txn.Hash(), txn.From, cost-sender.Balance)
+			cost = sender.Balance
+			value = transfer(txn, cost)
+			s.debits[txn.Hash()] = cost
+		}
+		sender.Balance -= cost
+		sender.Nonce++
+	}
+
+	receiver, err := s.get(txn.To)
+	if err != nil {
+		return err
+	}
+	receiver.Balance += value
+	return nil
+}
+
+// revertTxn undoes applyTxn, down to the amounts of a clamped transaction.
+func (s *accountState) revertTxn(txn *Transaction) error {
+	if txn.Status != constants.SUCCESS {
+		return nil
+	}
+
+	cost, value := txn.Cost(), txn.Value
+	if txn.From != constants.BLOCKCHAIN_ADDRESS {
+		debit, clamped, err := s.debit(txn)
+		if err != nil {
+			return err
+		}
+		if clamped {
+			cost, value = debit, transfer(txn, debit)
+			delete(s.debits, txn.Hash())
+		}
+	}
+
+	receiver, err := s.get(txn.To)
+	if err != nil {
+		return err
+	}
+	if receiver.Balance < value {
+		return fmt.Errorf("cannot revert transaction %s: %s holds %d of the %d it received", txn.Hash(), txn.To, receiver.Balance, value)
+	}
+	receiver.Balance -= value
+
+	if txn.From != constants.BLOCKCHAIN_ADDRESS {
+		sender, err := s.get(txn.From)
+		if err != nil {
+			return err
+		}
+		sender.Balance += cost
+		sender.Nonce--
+	}
+	return nil
+}
+
+// checkTxn fails with a NonceError when txn does not carry the next nonce
+// of its sender, and with an InsufficientBalanceError when the sender cannot
+// cover it.
+func (s *accountState) checkTxn(txn *Transaction) error {
+	if txn.From == constants.BLOCKCHAIN_ADDRESS {
+		return nil
+	}
+
+	sender, err := s.get(txn.From)
+	if err != nil {
+		return err
+	}
+	if txn.Nonce != sender.Nonce {
+		return &NonceError{Address: txn.From, Expected: sender.Nonce, Got: txn.Nonce}
+	}
+	if sender.Balance < txn.Cost() {
+		return &InsufficientBalanceError{Address: txn.From, Balance: sender.Balance, Required: txn.Cost()}
+	}
+	return nil
+}
+
+// checkBlock replays the transactions of b on the state and fails on the
+// first one that is out of nonce order or spends more than its sender has.
+func (s *accountState) checkBlock(b *Block) error {
+	for _, txn := range b.Transactions {
+		if txn.Status == constants.SUCCESS {
+			if err := s.checkTxn(txn); err != nil {
+				return fmt.Errorf("block %d: %w", b.BlockNumber, err)
+			}
+		}
+		if err := s.applyTxn(txn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBlockState reports whether b, applied on top of our chain, would
+// take any account below zero or reuse or skip a nonce.
+func (bc *BlockchainStruct) checkBlockState(b *Block) error {
+	return newAccountState(bc.Store).checkBlock(b)
+}
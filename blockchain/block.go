@@ -2,20 +2,35 @@
 package blockchain
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
-	"strings"
+	"fmt"
+	"math/big"
+	"sync"
 	"time"
 
 	"KNIRVCHAIN-MAIN/constants"
+	"KNIRVCHAIN-MAIN/merkle"
 )
 
+// BlockHeader is the part of a block that is hashed and mined. It commits
+// to the transactions of the block through their Merkle root, so a hash
+// attempt costs the same however many transactions the block carries.
+type BlockHeader struct {
+	BlockNumber uint64 `json:"block_number"`
+	PrevHash    string `json:"prevHash"`
+	MerkleRoot  string `json:"merkle_root,omitempty"`
+	Timestamp   int64  `json:"timestamp"`
+	Nonce       int    `json:"nonce"`
+	Bits        uint32 `json:"bits,omitempty"`
+}
+
+// Block is a header and the transactions that make up its body. Both
+// marshal into one flat JSON object.
 type Block struct {
-	BlockNumber  uint64         `json:"block_number"`
-	PrevHash     string         `json:"prevHash"`
-	Timestamp    int64          `json:"timestamp"`
-	Nonce        int            `json:"nonce"`
+	BlockHeader
 	Transactions []*Transaction `json:"transactions"`
 	// HashVal      string                     `json:"hash"` // Removed HashVal
 }
@@ -31,6 +46,14 @@ func NewBlock(prevHash string, nonce int, blockNumber uint64) *Block {
 	return block
 }
 
+// GenesisBlock is the first block of every chain. It is the same on every
+// node, so a chain that starts anywhere else is not ours.
+func GenesisBlock() *Block {
+	block := NewBlock("0x0", 0, 0)
+	block.Timestamp = constants.GENESIS_TIMESTAMP
+	return block
+}
+
 func (b Block) ToJson() string {
 	nb, err := json.Marshal(b)
 
@@ -55,27 +78,133 @@ func (b Block) ToJson() string {
 //		}
 //		return json.Marshal(aux)
 //	}
+
+// Hash is the hash of the block header. Blocks from before Merkle roots
+// carry none and keep the hash of the whole block they were mined with.
 func (b Block) Hash() string {
-	bs, _ := json.Marshal(b)
+	var bs []byte
+	if b.MerkleRoot != "" {
+		bs, _ = json.Marshal(b.BlockHeader)
+	} else {
+		bs, _ = json.Marshal(b)
+	}
 	sum := sha256.Sum256(bs)
 	hexRep := hex.EncodeToString(sum[:32])
 	formattedHexRep := constants.HEX_PREFIX + hexRep
 
 	return formattedHexRep
 }
-func (b *Block) Mine(difficulty int) error {
-	for {
-		b.Timestamp = time.Now().UnixNano()
-		guessHash := b.Hash()
-		desiredHash := strings.Repeat("0", difficulty)
-		ourSolutionHash := guessHash[2 : 2+difficulty]
-		if ourSolutionHash == desiredHash {
-			return nil
+
+// TransactionsRoot is the Merkle root over the transactions of the block.
+// Each leaf is the hash of a transaction followed by its status, which the
+// transaction hash leaves out but the block settles.
+func (b Block) TransactionsRoot() string {
+	return constants.HEX_PREFIX + hex.EncodeToString(merkle.Root(b.merkleLeaves()))
+}
+
+func (b Block) merkleLeaves() [][]byte {
+	leaves := make([][]byte, len(b.Transactions))
+	for i, txn := range b.Transactions {
+		leaves[i] = txn.merkleLeaf()
+	}
+	return leaves
+}
+
+// SetMerkleRoot commits the header to the transactions of the block. It is
+// called once the body is complete and before the block is mined.
+func (b *Block) SetMerkleRoot() {
+	b.MerkleRoot = b.TransactionsRoot()
+}
+
+// checkMerkleRoot fails unless the transactions of b are the ones its
+// header commits to. Only the genesis block, which is the same on every
+// node and carries no transactions, goes without a Merkle root.
+func (b Block) checkMerkleRoot() error {
+	if b.MerkleRoot == "" {
+		if b.BlockNumber != 0 {
+			return fmt.Errorf("block %d: has no merkle root", b.BlockNumber)
 		}
+		return nil
+	}
+	if root := b.TransactionsRoot(); root != b.MerkleRoot {
+		return fmt.Errorf("block %d: merkle root %s does not match its transactions' %s", b.BlockNumber, b.MerkleRoot, root)
+	}
+	return nil
+}
+
+// Target is the highest hash the block may have: the one its Bits encode,
+// or for blocks from before targets, which carry no Bits, the one
+// MINING_DIFFICULTY leading zero hex digits amount to.
+func (b Block) Target() *big.Int {
+	if b.Bits != 0 {
+		return CompactToTarget(b.Bits)
+	}
+	return zerosTarget(constants.MINING_DIFFICULTY)
+}
+
+// bits is the target of the block in compact form.
+func (b Block) bits() uint32 {
+	if b.Bits != 0 {
+		return b.Bits
+	}
+	return TargetToCompact(b.Target())
+}
+
+// Work is the number of hashes it takes on average to mine the block:
+// 2^256 divided by the number of hashes that meet its target.
+func (b Block) Work() *big.Int {
+	space := new(big.Int).Lsh(big.NewInt(1), 256)
+	hits := new(big.Int).Add(b.Target(), big.NewInt(1))
+	return space.Div(space, hits)
+}
+
+// Mine looks for a nonce that gives the block a hash within its target.
+// The nonces are split over workers goroutines, worker i trying every
+// workers-th nonce from the block's own plus i, each on its own copy of the
+// block. Mine returns ctx.Err(), leaving the block as it was, when ctx is
+// done before any worker finds one.
+func (b *Block) Mine(ctx context.Context, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	target := b.Target()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	found := make(chan Block, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		candidate := Block{BlockHeader: b.BlockHeader, Transactions: b.Transactions}
+		candidate.Nonce += i
 
-		b.Nonce++
+		wg.Add(1)
+		go func(candidate Block) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				candidate.Timestamp = time.Now().UnixNano()
+				if meetsProofOfWork(candidate.Hash(), target) {
+					select {
+					case found <- candidate:
+						cancel()
+					default:
+					}
+					return
+				}
+
+				candidate.Nonce += workers
+			}
+		}(candidate)
 	}
+	wg.Wait()
 
+	select {
+	case mined := <-found:
+		b.Nonce = mined.Nonce
+		b.Timestamp = mined.Timestamp
+		return nil
+	default:
+		return ctx.Err()
+	}
 }
 
 func (b *Block) AddTransactionToTheBlock(txn *Transaction) error {
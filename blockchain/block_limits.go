@@ -0,0 +1,43 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+// BlockLimits caps what a block may carry. MaxTxns counts the transactions
+// taken from the pool, so the reward does not count against it. MaxBytes
+// bounds the summed Size of all transactions of the block, reward included.
+type BlockLimits struct {
+	MaxTxns  int
+	MaxBytes int
+}
+
+func DefaultBlockLimits() BlockLimits {
+	return BlockLimits{
+		MaxTxns:  constants.TXN_PER_BLOCK_LIMIT,
+		MaxBytes: constants.MAX_BLOCK_SIZE,
+	}
+}
+
+// Check fails when b carries more transactions or bytes than the limits
+// allow.
+func (l BlockLimits) Check(b *Block) error {
+	txns := 0
+	size := 0
+	for _, txn := range b.Transactions {
+		if txn.From != constants.BLOCKCHAIN_ADDRESS {
+			txns++
+		}
+		size += txn.Size()
+	}
+
+	if txns > l.MaxTxns {
+		return fmt.Errorf("block %d has %d transactions, limit is %d", b.BlockNumber, txns, l.MaxTxns)
+	}
+	if size > l.MaxBytes {
+		return fmt.Errorf("block %d has %d bytes of transactions, limit is %d", b.BlockNumber, size, l.MaxBytes)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package blockchain
+
+import (
+	"testing"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+func TestBlockLimitsCheck(t *testing.T) {
+	b := NewBlock("0x0", 0, 1)
+	for i := 0; i < 3; i++ {
+		b.Transactions = append(b.Transactions, NewTransaction("alice", "bob", 1, []byte{}))
+	}
+	b.Transactions = append(b.Transactions, NewTransaction(constants.BLOCKCHAIN_ADDRESS, "miner", 1, []byte{}))
+
+	if err := (BlockLimits{MaxTxns: 3, MaxBytes: constants.MAX_BLOCK_SIZE}).Check(b); err != nil {
+		t.Errorf("Expected 3 transactions plus the reward to fit, got %v", err)
+	}
+	if err := (BlockLimits{MaxTxns: 2, MaxBytes: constants.MAX_BLOCK_SIZE}).Check(b); err == nil {
+		t.Error("Expected too many transactions to be reported")
+	}
+
+	size := 0
+	for _, txn := range b.Transactions {
+		size += txn.Size()
+	}
+	if err := (BlockLimits{MaxTxns: 3, MaxBytes: size - 1}).Check(b); err == nil {
+		t.Error("Expected too many bytes to be reported")
+	}
+}
@@ -0,0 +1,55 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+func TestBlockHashCoversHeader(t *testing.T) {
+	b := NewBlock("0xabc", 42, 7)
+	b.Transactions = append(b.Transactions, pendingTxn("alice", 3, 25))
+
+	// without a merkle root the whole block is hashed, as it always was
+	data, _ := json.Marshal(b)
+	sum := sha256.Sum256(data)
+	if legacy := constants.HEX_PREFIX + hex.EncodeToString(sum[:]); b.Hash() != legacy {
+		t.Errorf("Expected a block without a merkle root to hash to %s but got %s", legacy, b.Hash())
+	}
+
+	b.SetMerkleRoot()
+	hash := b.Hash()
+	b.Transactions[0].Fee++
+	if b.Hash() != hash {
+		t.Error("Expected the hash to cover only the header")
+	}
+	if err := b.checkMerkleRoot(); err == nil {
+		t.Error("Expected changed transactions to no longer match the merkle root")
+	}
+
+	// the status is settled by the block, so it is committed to as well
+	b.Transactions[0].Fee--
+	b.Transactions[0].Status = constants.FAILED
+	if err := b.checkMerkleRoot(); err == nil {
+		t.Error("Expected a changed status to no longer match the merkle root")
+	}
+}
+
+func TestLegacyBlockHash(t *testing.T) {
+	// a block as nodes wrote it before transactions carried fees and
+	// nonces; reading it back must not change its hash, or the blocks
+	// after it no longer link to it
+	legacy := `{"block_number":1,"prevHash":"0x368d272ba40441719307fdb7af898bf8e2d4a794b3fcdf838c8531e97d31722d","timestamp":1792222721247235487,"nonce":1107454,"transactions":[{"from":"KNIRVCHAIN_Faucet","to":"knirvchain_test_miner","value":120000,"data":"","status":"success","timestamp":1792222717709488241,"signature":""}]}`
+	var b Block
+	if err := json.Unmarshal([]byte(legacy), &b); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte(legacy))
+	if want := constants.HEX_PREFIX + hex.EncodeToString(sum[:]); b.Hash() != want {
+		t.Errorf("Expected the legacy block to hash to %s but got %s", want, b.Hash())
+	}
+}
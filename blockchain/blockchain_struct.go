@@ -1,13 +1,18 @@
 package blockchain
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"runtime"
 	"sync"
 	"time"
 
 	"KNIRVCHAIN-MAIN/constants"
+	"KNIRVCHAIN-MAIN/events"
 
 	"KNIRVCHAIN-MAIN/peerManager"
 
@@ -15,7 +20,7 @@ import (
 )
 
 type BlockchainStruct struct {
-	TransactionPool  []*Transaction                                    `json:"transaction_pool"`
+	Mempool          *Mempool                                          `json:"transaction_pool"`
 	Blocks           []*Block                                          `json:"block_chain"`
 	Address          string                                            `json:"address"`
 	Peers            map[string]bool                                   `json:"peers"`
@@ -23,67 +28,120 @@ type BlockchainStruct struct {
 	Broadcaster      transactionBroadcaster.TransactionBroadcaster     `json:"-"`
 	BlockAdded       chan transactionBroadcaster.BlockAddedEvent       `json:"-"`
 	TransactionAdded chan transactionBroadcaster.TransactionAddedEvent `json:"-"`
+	ChainReorg       chan events.ChainReorgEvent                       `json:"-"`
 	PeerManager      *peerManager.PeerManager                          `json:"-"`
+	Limits           BlockLimits                                       `json:"-"`
+	Retarget         Retarget                                          `json:"-"`
+	MiningWorkers    int                                               `json:"-"`
+	Store            ChainStore                                        `json:"-"`
 	Mutex            sync.Mutex                                        `json:"-"`
+	tipChanged       chan struct{}
 }
 
-var mutex sync.Mutex
+func NewBlockchain(store ChainStore, genesisBlock Block, address string, broadcaster transactionBroadcaster.TransactionBroadcaster, peerManager *peerManager.PeerManager) *BlockchainStruct {
+	blockchainStruct := new(BlockchainStruct)
+	blockchainStruct.Mempool = NewMempool(DefaultMempoolConfig())
+	blockchainStruct.Mempool.journal = store
+	blockchainStruct.Blocks = []*Block{}
+	blockchainStruct.Address = address
+	blockchainStruct.Peers = map[string]bool{}
+	blockchainStruct.MiningLocked = false
+	blockchainStruct.BlockAdded = make(chan transactionBroadcaster.BlockAddedEvent)
+	blockchainStruct.TransactionAdded = make(chan transactionBroadcaster.TransactionAddedEvent)
+	blockchainStruct.ChainReorg = make(chan events.ChainReorgEvent, constants.EVENT_CHANNEL_BUFFER)
+	blockchainStruct.Broadcaster = broadcaster
+	blockchainStruct.PeerManager = peerManager
+	blockchainStruct.Limits = DefaultBlockLimits()
+	blockchainStruct.Retarget = DefaultRetarget()
+	blockchainStruct.MiningWorkers = runtime.NumCPU()
+	blockchainStruct.Store = store
+	blockchainStruct.Mutex = sync.Mutex{}
+
+	if legacy, _ := KeyExists(store); legacy {
+		old, err := GetBlockchain(store)
+		if err != nil {
+			panic(err.Error())
+		}
+		if err := MigrateLegacyBlockchain(store, old); err != nil {
+			panic(err.Error())
+		}
+		log.Printf("Migrated %d blocks to per-block storage", len(old.Blocks))
+	}
 
-func NewBlockchain(genesisBlock Block, address string, broadcaster transactionBroadcaster.TransactionBroadcaster, peerManager *peerManager.PeerManager) *BlockchainStruct {
-	exists, _ := KeyExists()
+	exists, err := HeadExists(store)
+	if err != nil {
+		panic(err.Error())
+	}
 
 	if exists {
-
-		blockchainStruct, err := GetBlockchain()
-		blockchainStruct.Broadcaster = broadcaster
+		blocks, err := GetBlocks(store)
 		if err != nil {
 			panic(err.Error())
 		}
-		return blockchainStruct
+		blockchainStruct.Blocks = blocks
 	} else {
-		blockchainStruct := new(BlockchainStruct)
-		blockchainStruct.TransactionPool = []*Transaction{}
-		blockchainStruct.Blocks = []*Block{}
 		blockchainStruct.Blocks = append(blockchainStruct.Blocks, &genesisBlock)
-		blockchainStruct.Address = address
-		blockchainStruct.Peers = map[string]bool{}
-		blockchainStruct.MiningLocked = false
-		blockchainStruct.BlockAdded = make(chan transactionBroadcaster.BlockAddedEvent)
-		blockchainStruct.TransactionAdded = make(chan transactionBroadcaster.TransactionAddedEvent)
-		blockchainStruct.Broadcaster = broadcaster
-		blockchainStruct.PeerManager = peerManager
-		blockchainStruct.Mutex = sync.Mutex{}
-		//	err := PutIntoDb(*blockchainStruct)
-		//if err != nil {
-		//	panic(err.Error())
-		//}
-		return blockchainStruct
+		if err := PutBlock(store, &genesisBlock); err != nil {
+			panic(err.Error())
+		}
 	}
-}
 
-func NewBlockchainFromSync(remoteBlocks []*peerManager.RemoteBlock, address string, broadcaster transactionBroadcaster.TransactionBroadcaster, peerManager *peerManager.PeerManager) *BlockchainStruct {
-	// 1. Convert RemoteBlock to Block: Deep copy is essential to avoid modification issues
-	blocks := make([]*Block, len(remoteBlocks))
-	for i, rb := range remoteBlocks {
-		block := &Block{
-			BlockNumber: rb.BlockNumber,
-			Nonce:       rb.Nonce,
-			PrevHash:    rb.PrevHash,
-			Timestamp:   rb.Timestamp,
+	if !indexIsCurrent(store) {
+		if err := reindexChain(store, blockchainStruct.Blocks); err != nil {
+			panic(err.Error())
 		}
+	}
 
-		blocks[i] = block
+	if err := blockchainStruct.restoreMempool(); err != nil {
+		panic(err.Error())
+	}
+
+	return blockchainStruct
+}
+
+// NewBlockchainFromSync builds our chain from the blocks of
+// peerManager.SyncBlockchain.
+//
+// Deprecated: start from NewBlockchain and sync with a Syncer.
+func NewBlockchainFromSync(store ChainStore, remoteBlocks []*peerManager.RemoteBlock, address string, broadcaster transactionBroadcaster.TransactionBroadcaster, peerManager *peerManager.PeerManager) *BlockchainStruct {
+	// 1. Convert RemoteBlock to Block, keeping every transaction and checking
+	// each block still hashes to what the peer mined
+	blocks, err := BlocksFromRemote(remoteBlocks)
+	if err != nil {
+		panic(err.Error())
 	}
 
 	bc := &BlockchainStruct{
-		Blocks:       blocks,
+		Mempool:      NewMempool(DefaultMempoolConfig()),
+		Blocks:       []*Block{},
 		Address:      address, // Your blockchain node's address
 		Peers:        make(map[string]bool),
+		ChainReorg:   make(chan events.ChainReorgEvent, constants.EVENT_CHANNEL_BUFFER),
 		Broadcaster:  broadcaster, // Your transaction broadcaster
 		MiningLocked: false,       // Add other necessary fields
 		PeerManager:  peerManager,
+		Limits:       DefaultBlockLimits(),
+		Retarget:     DefaultRetarget(),
+		Store:        store,
 		Mutex:        sync.Mutex{},
 	}
+	bc.MiningWorkers = runtime.NumCPU()
+
+	// 2. Replay the whole chain from its genesis before trusting any of it
+	if err := bc.ValidateChainSegment(blocks); err != nil {
+		panic(err.Error())
+	}
+	bc.Blocks = blocks
+	if err := PutChain(store, blocks); err != nil {
+		panic(err.Error())
+	}
+	if err := reindexChain(store, blocks); err != nil {
+		panic(err.Error())
+	}
+	bc.Mempool.journal = store
+	if err := bc.restoreMempool(); err != nil {
+		panic(err.Error())
+	}
 	return bc
 }
 
@@ -97,73 +155,103 @@ func (bc *BlockchainStruct) ToJson() string {
 	}
 }
 
+// Close releases the blockchain's database handle.
+func (bc *BlockchainStruct) Close() error {
+	return bc.Store.Close()
+}
+
 func (bc *BlockchainStruct) AddBlock(b *Block) {
 	bc.Mutex.Lock()
 	defer bc.Mutex.Unlock()
+	bc.addBlock(b)
+}
 
-	m := map[string]bool{}
-	for _, txn := range b.Transactions {
-		m[txn.Hash()] = true
-	}
-
-	// remove txn from txn pool
-	newTxnPool := []*Transaction{}
-	for _, txn := range bc.TransactionPool {
-		_, ok := m[txn.Hash()]
-		if !ok {
-			newTxnPool = append(newTxnPool, txn)
-		}
+// addMinedBlock adds b, unless the chain moved on from the block b was
+// mined on top of while it was being mined.
+func (bc *BlockchainStruct) addMinedBlock(b *Block) bool {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+	if b.PrevHash != bc.Blocks[len(bc.Blocks)-1].Hash() {
+		return false
 	}
+	bc.addBlock(b)
+	return true
+}
 
-	bc.TransactionPool = newTxnPool
-
+// addBlock appends b to the chain. The caller holds bc.Mutex.
+func (bc *BlockchainStruct) addBlock(b *Block) {
 	bc.Blocks = append(bc.Blocks, b)
+	bc.notifyTipChanged()
 
-	// save the blockchain to our database
-	err := PutIntoDb(bc)
-	if err != nil {
+	// save the new block to our database, then take its txns out of the
+	// pool, so a crash in between leaves them journaled rather than lost
+	if err := PutBlock(bc.Store, b); err != nil {
+		panic(err.Error())
+	}
+	if err := bc.Mempool.RemoveBlock(b); err != nil {
 		panic(err.Error())
 	}
 	//bc.BlockAdded <- events.BlockAddedEvent{Block: transaction} // Send the event to the event channel
 	log.Printf("Block added: %+v", b) // Log only if necessary
 }
 
-func (bc *BlockchainStruct) appendTransactionToTheTransactionPool(transaction *Transaction) {
-	mutex.Lock()
-	defer mutex.Unlock()
+// TipChanged returns a channel that is closed as soon as the last block of
+// the chain changes, by a block added to it or by a switch to another chain.
+func (bc *BlockchainStruct) TipChanged() <-chan struct{} {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+	return bc.tipChangedLocked()
+}
 
-	bc.TransactionPool = append(bc.TransactionPool, transaction)
+// tipChangedLocked is TipChanged for a caller that holds the lock.
+func (bc *BlockchainStruct) tipChangedLocked() <-chan struct{} {
+	if bc.tipChanged == nil {
+		bc.tipChanged = make(chan struct{})
+	}
+	return bc.tipChanged
+}
 
-	// save the blockchain to our database
-	err := PutIntoDb(bc)
-	if err != nil {
-		panic(err.Error())
+// notifyTipChanged wakes whoever waits on TipChanged. The caller holds
+// bc.Mutex.
+func (bc *BlockchainStruct) notifyTipChanged() {
+	if bc.tipChanged != nil {
+		close(bc.tipChanged)
+		bc.tipChanged = nil
 	}
 }
 
+// appendTransactionToTheTransactionPool adds transaction to the mempool,
+// which also writes it to its journal.
+func (bc *BlockchainStruct) appendTransactionToTheTransactionPool(transaction *Transaction) error {
+	return bc.Mempool.Add(transaction)
+}
+
 func (bc *BlockchainStruct) AddTransactionToTransactionPool(transaction *Transaction) {
 
-	for _, txn := range bc.TransactionPool {
-		if txn.Hash() == transaction.Hash() {
-			return
-		}
+	if bc.Mempool.Get(transaction.Hash()) != nil {
+		return
 	}
 
 	log.Println("Adding txn to the Transaction pool")
 
-	valid1 := transaction.VerifyTxn()
-
-	//valid2 := bc.simulatedBalanceCheck(valid1, transaction)
+	valid := transaction.VerifyTxn()
+	if valid {
+		if err := bc.checkAdmission(transaction); err != nil {
+			log.Println("Rejecting txn:", err)
+			valid = false
+		}
+	}
 
-	if valid1 {
+	if valid {
 		transaction.Status = constants.TXN_VERIFICATION_SUCCESS
 	} else {
 		transaction.Status = constants.TXN_VERIFICATION_FAILURE
 	}
 
-	transaction.PublicKey = ""
-
-	bc.appendTransactionToTheTransactionPool(transaction)
+	if err := bc.appendTransactionToTheTransactionPool(transaction); err != nil {
+		log.Println("Dropping txn:", err)
+		return
+	}
 
 	bc.BroadcastLocalTransaction(transaction)
 
@@ -176,113 +264,249 @@ func (bc *BlockchainStruct) BroadcastLocalTransaction(txn *Transaction) {
 	//bc.TransactionAdded <- events.TransactionAddedEvent{Transaction: txn} // Send the event to the event channel
 }
 
-func (bc *BlockchainStruct) simulatedBalanceCheck(valid1 bool, transaction *Transaction) bool {
-	balance := bc.CalculateTotalCrypto(transaction.From)
-	for _, txn := range bc.TransactionPool {
-		if transaction.From == txn.From && valid1 {
-			if balance >= txn.Value {
-				balance -= txn.Value
-			} else {
-				break
+// spendableBalance is the confirmed balance of address minus what its
+// transactions already waiting in the pool spend, fees included. A pending
+// transaction that is about to be replaced does not count.
+func (bc *BlockchainStruct) spendableBalance(address string, replaced *Transaction) (uint64, error) {
+	account, err := bc.GetAccount(address)
+	if err != nil {
+		return 0, err
+	}
+
+	balance := account.Balance
+	for _, txn := range bc.Mempool.Transactions() {
+		if txn == replaced {
+			continue
+		}
+		if txn.From == address && txn.Status != constants.TXN_VERIFICATION_FAILURE {
+			if txn.Cost() > balance {
+				return 0, nil
 			}
+			balance -= txn.Cost()
 		}
 	}
+	return balance, nil
+}
+
+// NextNonce is the nonce the next transaction of address has to carry: the
+// confirmed nonce plus its transactions already waiting in the pool.
+func (bc *BlockchainStruct) NextNonce(address string) (uint64, error) {
+	account, err := bc.GetAccount(address)
+	if err != nil {
+		return 0, err
+	}
 
-	return balance >= transaction.Value
+	nonce := account.Nonce
+	for _, txn := range bc.Mempool.Transactions() {
+		if txn.From == address && txn.Status != constants.TXN_VERIFICATION_FAILURE {
+			nonce++
+		}
+	}
+	return nonce, nil
 }
 
-func (bc *BlockchainStruct) MineNewBlock(minersAddress string) (*Block, error) {
-	bc.MiningLocked = true // Lock mining during block creation
+// checkAdmission fails with a NonceError when txn neither carries the next
+// nonce of its sender nor the nonce of one of its pending transactions, and
+// with an InsufficientBalanceError when the sender cannot cover it on top of
+// its other pending transactions. Whether a replacement pays enough is up to
+// the mempool.
+func (bc *BlockchainStruct) checkAdmission(txn *Transaction) error {
+	nonce, err := bc.NextNonce(txn.From)
+	if err != nil {
+		return err
+	}
 
-	defer func() { bc.MiningLocked = false }() // Unlock *always*, even if error
+	var replaced *Transaction
+	if txn.Nonce < nonce {
+		replaced = bc.Mempool.Pending(txn.From, txn.Nonce)
+	}
+	if txn.Nonce != nonce && replaced == nil {
+		return &NonceError{Address: txn.From, Expected: nonce, Got: txn.Nonce}
+	}
+
+	spendable, err := bc.spendableBalance(txn.From, replaced)
+	if err != nil {
+		return err
+	}
+	if spendable < txn.Cost() {
+		return &InsufficientBalanceError{Address: txn.From, Balance: spendable, Required: txn.Cost()}
+	}
+	return nil
+}
+
+// SetMiningLocked sets MiningLocked, which keeps new transactions out and
+// the miner idle while a block is assembled or the chain is switched.
+func (bc *BlockchainStruct) SetMiningLocked(locked bool) {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+	bc.MiningLocked = locked
+}
+
+// IsMiningLocked reports whether MiningLocked is set.
+func (bc *BlockchainStruct) IsMiningLocked() bool {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+	return bc.MiningLocked
+}
+
+// MineNewBlock mines a block on top of our chain with bc.MiningWorkers
+// workers. Mining is abandoned, with context.Canceled, as soon as the chain
+// tip changes, since the block would no longer extend it, or with ctx's
+// error when ctx is done. Mining is locked only while the block is
+// assembled; during the search for its nonce transactions keep coming in
+// and consensus may move the tip.
+func (bc *BlockchainStruct) MineNewBlock(ctx context.Context, minersAddress string) (*Block, error) {
+	bc.SetMiningLocked(true)
+	newBlock, tipChanged, err := bc.newBlockTemplate(minersAddress)
+	bc.SetMiningLocked(false)
+	if err != nil {
+		return nil, err
+	}
+	if err := bc.mineTemplate(ctx, newBlock, tipChanged); err != nil {
+		return nil, err
+	}
+	return newBlock, nil
+}
+
+// mineTemplate mines b until it meets its target, tipChanged is closed or
+// ctx is done.
+func (bc *BlockchainStruct) mineTemplate(ctx context.Context, b *Block, tipChanged <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-tipChanged:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := b.Mine(ctx, bc.MiningWorkers); err != nil {
+		return fmt.Errorf("mining error: %w", err)
+	}
+	return nil
+}
+
+// newBlockTemplate builds the block to mine on top of our chain, and
+// returns it with the channel that is closed once it no longer extends the
+// tip. Both come from one look at the chain under the lock, so a block
+// added meanwhile cannot slip in between them unnoticed.
+func (bc *BlockchainStruct) newBlockTemplate(minersAddress string) (*Block, <-chan struct{}, error) {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
 
+	tipChanged := bc.tipChangedLocked()
 	prevHash := bc.Blocks[len(bc.Blocks)-1].Hash()
 	newBlock := NewBlock(prevHash, 0, uint64(len(bc.Blocks))) // nonce starts at 0
+	newBlock.Bits = bc.Retarget.NextBits(bc.Blocks)
+
+	// Deep copy transactions from the pool, best paying first, leaving the
+	// ones that did not verify, whose sender cannot cover them, that are out of nonce order, or
+	// that do not fit in the block limits, in the pool. Room for the reward
+	// is kept aside; its value is at most MaxUint64.
+	state := newAccountState(bc.Store)
+	var fees uint64
+	size := NewTransaction(constants.BLOCKCHAIN_ADDRESS, minersAddress, math.MaxUint64, []byte{}).Size()
+	bc.Mempool.Expire(time.Now())
+	for _, txn := range orderByFeeRate(bc.Mempool.Transactions()) {
+		if len(newBlock.Transactions) == bc.Limits.MaxTxns {
+			break
+		}
+		if txn.Status != constants.TXN_VERIFICATION_SUCCESS || size+txn.Size() > bc.Limits.MaxBytes {
+			continue
+		}
 
-	// Deep copy transactions from the pool
-	for _, txn := range bc.TransactionPool {
 		newTxn := NewTransaction(txn.From, txn.To, txn.Value, txn.Data)
+		newTxn.Fee = txn.Fee
+		newTxn.Nonce = txn.Nonce
 		newTxn.Timestamp = txn.Timestamp
 		newTxn.Status = txn.Status
 		newTxn.Signature = txn.Signature
 		newTxn.PublicKey = txn.PublicKey // Ensure public key is copied
+		if err := state.checkTxn(newTxn); err != nil {
+			log.Println("Leaving txn in the pool:", err)
+			continue
+		}
 		if err := newBlock.AddTransactionToTheBlock(newTxn); err != nil {
-			return nil, fmt.Errorf("failed to add transaction to block: %w", err)
+			return nil, nil, fmt.Errorf("failed to add transaction to block: %w", err)
 		}
-
+		if err := state.applyTxn(newTxn); err != nil {
+			return nil, nil, fmt.Errorf("failed to apply transaction: %w", err)
+		}
+		size += newTxn.Size()
+		fees += newTxn.Fee
 	}
 
-	rewardTxn := NewTransaction(constants.BLOCKCHAIN_ADDRESS, minersAddress, constants.MINING_REWARD, []byte{})
+	// the miner collects the fees of the block on top of the reward
+	rewardTxn := NewTransaction(constants.BLOCKCHAIN_ADDRESS, minersAddress, constants.MINING_REWARD+fees, []byte{})
 	rewardTxn.Status = constants.SUCCESS
-	if err := newBlock.AddTransactionToTheBlock(rewardTxn); err != nil {
-		return nil, fmt.Errorf("failed to add reward transaction: %w", err)
-	}
-
-	if err := newBlock.Mine(constants.MINING_DIFFICULTY); err != nil {
-		return nil, fmt.Errorf("mining error: %w", err)
-	}
-	return newBlock, nil
+	// the reward is minted rather than verified, and AddTransactionToTheBlock
+	// would mark it failed
+	newBlock.Transactions = append(newBlock.Transactions, rewardTxn)
+	newBlock.SetMerkleRoot()
+	return newBlock, tipChanged, nil
 }
 
+// ProofOfWorkMining mines blocks on top of our chain until stopMining
+// fires, which also abandons the block being mined. A block whose parent
+// stopped being the chain tip is abandoned too, and mining restarts on the
+// new tip.
 func (bc *BlockchainStruct) ProofOfWorkMining(minersAddress string, stopMining <-chan bool, miningStopped chan<- bool) {
-	for {
-
-		if bc.MiningLocked {
-			time.Sleep(constants.MINING_PAUSE_TIME * time.Second)
-			continue
-		}
-
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
 		select {
 		case <-stopMining:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
+	for {
+		if ctx.Err() != nil {
 			miningStopped <- true
 			return
+		}
 
-		default:
-
-			newBlock, err := bc.MineNewBlock(minersAddress)
-			if err != nil {
-				log.Println("Error Mining Block: ", err)
-
-				continue // Don't crash, try again in the next iteration
-			}
-
-			if !bc.MiningLocked {
-				bc.AddBlock(newBlock)
-				log.Println("Mined block number:", newBlock.BlockNumber)
-				bc.BroadcastLocalTransaction(newBlock.Transactions[len(newBlock.Transactions)-1])
+		if bc.IsMiningLocked() {
+			time.Sleep(constants.MINING_PAUSE_TIME * time.Second)
+			continue
+		}
 
-			}
+		newBlock, err := bc.MineNewBlock(ctx, minersAddress)
+		if errors.Is(err, context.Canceled) {
+			continue // stopped, or the tip changed under us
+		}
+		if err != nil {
+			log.Println("Error Mining Block: ", err)
 
+			continue // Don't crash, try again in the next iteration
 		}
 
+		if !bc.IsMiningLocked() && bc.addMinedBlock(newBlock) {
+			log.Println("Mined block number:", newBlock.BlockNumber)
+			bc.BroadcastLocalTransaction(newBlock.Transactions[len(newBlock.Transactions)-1])
+		}
 	}
-
 }
 
+// CalculateTotalCrypto returns the confirmed balance of address.
 func (bc *BlockchainStruct) CalculateTotalCrypto(address string) uint64 {
-	sum := uint64(0)
-
-	for _, blocks := range bc.Blocks {
-		for _, txns := range blocks.Transactions {
-			if txns.Status == constants.SUCCESS {
-				if txns.To == address {
-					sum += txns.Value
-				} else if txns.From == address {
-					sum -= txns.Value
-				}
-			}
-		}
+	account, err := bc.GetAccount(address)
+	if err != nil {
+		log.Println("Error reading account:", err)
+		return 0
 	}
-	return sum
+	return account.Balance
 }
 
 func (bc *BlockchainStruct) GetAllTxns() []Transaction {
 
 	nTxns := []Transaction{}
 
-	for i := len(bc.TransactionPool) - 1; i >= 0; i-- {
-		nTxns = append(nTxns, *bc.TransactionPool[i])
+	pool := bc.Mempool.Transactions()
+	for i := len(pool) - 1; i >= 0; i-- {
+		nTxns = append(nTxns, *pool[i])
 	}
 
 	txns := []Transaction{}
@@ -311,7 +535,14 @@ func (bc *BlockchainStruct) AddTransaction(txn Transaction) error {
 		return fmt.Errorf("txn verification failed")
 	}
 
-	bc.TransactionPool = append(bc.TransactionPool, &txn)
+	if err := bc.checkAdmission(&txn); err != nil {
+		return err
+	}
+
+	txn.Status = constants.TXN_VERIFICATION_SUCCESS
+	if err := bc.appendTransactionToTheTransactionPool(&txn); err != nil {
+		return err
+	}
 	//bc.TransactionAdded <- events.TransactionAddedEvent{Transaction: &txn} // Send event *after* adding to pool
 	return nil
 
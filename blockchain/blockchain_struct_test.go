@@ -0,0 +1,111 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+// fund adds a block to bc that pays value to address, at the target of
+// the block before it.
+func fund(bc *BlockchainStruct, address string, value uint64) {
+	prev := bc.Blocks[len(bc.Blocks)-1]
+	reward := NewTransaction(constants.BLOCKCHAIN_ADDRESS, address, value, []byte{})
+	reward.Status = constants.SUCCESS
+	b := NewBlock(prev.Hash(), 0, prev.BlockNumber+1)
+	b.Bits = prev.Bits
+	b.Transactions = append(b.Transactions, reward)
+	b.SetMerkleRoot()
+	bc.AddBlock(b)
+}
+
+func TestAddTransactionRefusesOverdraft(t *testing.T) {
+	alice := newTestKey(t)
+	bc := NewBlockchain(NewMemoryStore(), *NewBlock("0x0", 0, 0), "", nil, nil)
+	fund(bc, alice.address, 100)
+
+	var insufficient *InsufficientBalanceError
+	if err := bc.AddTransaction(*alice.sign(t, "bob", 100, 1, 0)); !errors.As(err, &insufficient) {
+		t.Errorf("Expected value plus fee above the balance to be refused, got %v", err)
+	}
+	if err := bc.AddTransaction(*alice.sign(t, "bob", 60, 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// what is already pending counts against the balance
+	err := bc.AddTransaction(*alice.sign(t, "bob", 39, 1, 1))
+	if !errors.As(err, &insufficient) {
+		t.Fatalf("Expected a txn the pending one leaves no room for to be refused, got %v", err)
+	}
+	if insufficient.Balance != 39 || insufficient.Required != 40 {
+		t.Errorf("Expected 39 spendable against 40 required, got %+v", insufficient)
+	}
+}
+
+func TestMineNewBlockLeavesOverdraftAndUnverifiedInPool(t *testing.T) {
+	alice := newTestKey(t)
+	bc := NewBlockchain(NewMemoryStore(), *testGenesis(), "", nil, nil)
+	bc.MiningWorkers = 1
+	fund(bc, alice.address, 100)
+
+	// both were admitted, but together they spend more than alice has
+	first := alice.sign(t, "bob", 60, 1, 0)
+	second := alice.sign(t, "bob", 60, 1, 1)
+	for _, txn := range []*Transaction{first, second} {
+		txn.Status = constants.TXN_VERIFICATION_SUCCESS
+		if err := bc.Mempool.Add(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a gossiped txn that did not verify waits in the pool, but is never
+	// mined
+	unverified := pendingTxn("carol", 0, 50)
+	unverified.Status = constants.TXN_VERIFICATION_FAILURE
+	if err := bc.Mempool.Add(unverified); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bc.MineNewBlock(context.Background(), "miner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Transactions) != 2 || b.Transactions[0].Hash() != first.Hash() {
+		t.Fatalf("Expected only alice's first txn and the reward in the block, got %d txns", len(b.Transactions))
+	}
+	if err := bc.ValidateBlock(b); err != nil {
+		t.Errorf("Expected the mined block to validate, got %v", err)
+	}
+}
+
+func TestAddTransactionChecksNonce(t *testing.T) {
+	alice := newTestKey(t)
+	bc := NewBlockchain(NewMemoryStore(), *NewBlock("0x0", 0, 0), "", nil, nil)
+	fund(bc, alice.address, 100)
+
+	// alice's first spend is confirmed, so her account is at nonce 1
+	spend := alice.sign(t, "bob", 10, 0, 0)
+	prev := bc.Blocks[len(bc.Blocks)-1]
+	b := NewBlock(prev.Hash(), 0, prev.BlockNumber+1)
+	b.Transactions = append(b.Transactions, spend)
+	bc.AddBlock(b)
+
+	var nonceErr *NonceError
+	if err := bc.AddTransaction(*alice.sign(t, "bob", 10, 1, 0)); !errors.As(err, &nonceErr) || nonceErr.Expected != 1 || nonceErr.Got != 0 {
+		t.Errorf("Expected a spent nonce to be refused as too low, got %v", err)
+	}
+	if err := bc.AddTransaction(*alice.sign(t, "bob", 10, 1, 5)); !errors.As(err, &nonceErr) || nonceErr.Expected != 1 || nonceErr.Got != 5 {
+		t.Errorf("Expected a nonce past the next one to be refused as too high, got %v", err)
+	}
+
+	if err := bc.AddTransaction(*alice.sign(t, "bob", 10, 1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if nonce, err := bc.NextNonce(alice.address); err != nil || nonce != 2 {
+		t.Errorf("Expected the pending txn to move the next nonce to 2, got %d (%v)", nonce, err)
+	}
+	if err := bc.AddTransaction(*alice.sign(t, "bob", 10, 1, 2)); err != nil {
+		t.Errorf("Expected the next nonce after the pending txn to be accepted, got %v", err)
+	}
+}
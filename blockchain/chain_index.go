@@ -0,0 +1,288 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+// TxnLocation is the position of a transaction inside the chain.
+type TxnLocation struct {
+	BlockNumber uint64 `json:"block_number"`
+	Index       int    `json:"index"`
+}
+
+// TxnReceipt is a transaction looked up by hash. Block is nil and
+// Confirmations is 0 while the transaction is still in the pool.
+type TxnReceipt struct {
+	Transaction   *Transaction `json:"transaction"`
+	Block         *Block       `json:"block"`
+	BlockHash     string       `json:"block_hash,omitempty"`
+	Index         int          `json:"index"`
+	Confirmations uint64       `json:"confirmations"`
+}
+
+// AddressTxn is one line of an address statement. Balance is the balance of
+// the address right after the transaction.
+type AddressTxn struct {
+	Cursor      string       `json:"cursor"`
+	BlockNumber uint64       `json:"block_number"`
+	Index       int          `json:"index"`
+	Transaction *Transaction `json:"transaction"`
+	Balance     uint64       `json:"balance"`
+}
+
+// AddressTxnPage is one page of an address statement. NextCursor is empty
+// on the last page.
+type AddressTxnPage struct {
+	Address      string        `json:"address"`
+	Transactions []*AddressTxn `json:"transactions"`
+	NextCursor   string        `json:"next_cursor,omitempty"`
+}
+
+func txnIndexKey(hash string) []byte {
+	return []byte(constants.TXN_INDEX_PREFIX + hash)
+}
+
+func addressTxnCursor(blockNumber uint64, index int) string {
+	return fmt.Sprintf("%020d_%06d", blockNumber, index)
+}
+
+func addressTxnPrefix(address string) []byte {
+	return []byte(constants.ADDRESS_TXN_PREFIX + address + "_")
+}
+
+func addressTxnKey(address string, blockNumber uint64, index int) []byte {
+	return append(addressTxnPrefix(address), addressTxnCursor(blockNumber, index)...)
+}
+
+// statementAddresses returns the addresses whose statement lists txn. The
+// faucet mints rewards and does not keep a statement.
+func statementAddresses(txn *Transaction) []string {
+	addresses := []string{txn.To}
+	if txn.From != constants.BLOCKCHAIN_ADDRESS && txn.From != txn.To {
+		addresses = append(addresses, txn.From)
+	}
+	return addresses
+}
+
+// chainIndexer collects the index, account and chain work writes for a run
+// of blocks into a single batch, so a block and its effects are stored
+// atomically.
+type chainIndexer struct {
+	store ChainStore
+	batch *StoreBatch
+	state *accountState
+	work  map[uint64]*big.Int
+}
+
+func newChainIndexer(store ChainStore, batch *StoreBatch) *chainIndexer {
+	return &chainIndexer{
+		store: store,
+		batch: batch,
+		state: newAccountState(store),
+		work:  map[uint64]*big.Int{},
+	}
+}
+
+func (ix *chainIndexer) putAccount(address string) (*Account, error) {
+	account, err := ix.state.get(address)
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(account)
+	if err != nil {
+		return nil, err
+	}
+	ix.batch.Put(accountKey(address), value)
+	return account, nil
+}
+
+// indexBlock applies b to the account table, records its chain work and
+// adds the index entries of every transaction in it.
+func (ix *chainIndexer) indexBlock(b *Block) error {
+	if err := ix.putChainWork(b); err != nil {
+		return err
+	}
+
+	for i, txn := range b.Transactions {
+		value, err := json.Marshal(TxnLocation{BlockNumber: b.BlockNumber, Index: i})
+		if err != nil {
+			return err
+		}
+		ix.batch.Put(txnIndexKey(txn.Hash()), value)
+
+		if err := ix.state.applyTxn(txn); err != nil {
+			return err
+		}
+		if debit, ok := ix.state.debits[txn.Hash()]; ok {
+			ix.batch.Put(clampedDebitKey(txn.Hash()), []byte(strconv.FormatUint(debit, 10)))
+		}
+
+		for _, address := range statementAddresses(txn) {
+			account, err := ix.putAccount(address)
+			if err != nil {
+				return err
+			}
+
+			entry, err := json.Marshal(AddressTxn{
+				Cursor:      addressTxnCursor(b.BlockNumber, i),
+				BlockNumber: b.BlockNumber,
+				Index:       i,
+				Transaction: txn,
+				Balance:     account.Balance,
+			})
+			if err != nil {
+				return err
+			}
+			ix.batch.Put(addressTxnKey(address, b.BlockNumber, i), entry)
+		}
+	}
+	return nil
+}
+
+// unindexBlock removes the index entries written by indexBlock and rolls
+// the account table back to before b.
+func (ix *chainIndexer) unindexBlock(b *Block) error {
+	delete(ix.work, b.BlockNumber)
+	ix.batch.Delete(chainWorkKey(b.Hash()))
+
+	for i := len(b.Transactions) - 1; i >= 0; i-- {
+		txn := b.Transactions[i]
+		ix.batch.Delete(txnIndexKey(txn.Hash()))
+
+		if err := ix.state.revertTxn(txn); err != nil {
+			return err
+		}
+		ix.batch.Delete(clampedDebitKey(txn.Hash()))
+
+		for _, address := range statementAddresses(txn) {
+			if _, err := ix.putAccount(address); err != nil {
+				return err
+			}
+			ix.batch.Delete(addressTxnKey(address, b.BlockNumber, i))
+		}
+	}
+	return nil
+}
+
+// reindexChain rebuilds every index from blocks. It runs when the store was
+// written by a version of the node that kept fewer or different indexes.
+// Such a chain may hold overdrafts from before balances were checked; their
+// senders are left at zero.
+func reindexChain(store ChainStore, blocks []*Block) error {
+	batch := NewStoreBatch()
+	ix := newChainIndexer(store, batch)
+	ix.state.rebuild = true
+	ix.state.clamp = true
+	for _, b := range blocks {
+		if err := ix.indexBlock(b); err != nil {
+			return err
+		}
+	}
+	batch.Put([]byte(constants.CHAIN_INDEX_VERSION_KEY), []byte(strconv.Itoa(constants.CHAIN_INDEX_VERSION)))
+	return store.Write(batch)
+}
+
+func indexIsCurrent(store ChainStore) bool {
+	data, err := store.Get([]byte(constants.CHAIN_INDEX_VERSION_KEY))
+	if err != nil {
+		return false
+	}
+	return string(data) == strconv.Itoa(constants.CHAIN_INDEX_VERSION)
+}
+
+func GetTxnLocation(store ChainStore, hash string) (*TxnLocation, error) {
+	data, err := store.Get(txnIndexKey(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	var location TxnLocation
+	if err := json.Unmarshal(data, &location); err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
+
+// GetTransactionByHash finds a transaction in the chain, or failing that in
+// the transaction pool. It returns ErrNotFound when neither has it. The
+// lock keeps a reorg from rewriting the store between the lookups.
+func (bc *BlockchainStruct) GetTransactionByHash(hash string) (*TxnReceipt, error) {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+
+	location, err := GetTxnLocation(bc.Store, hash)
+	if err == ErrNotFound {
+		if txn := bc.Mempool.Get(hash); txn != nil {
+			return &TxnReceipt{Transaction: txn}, nil
+		}
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	height := uint64(len(bc.Blocks))
+	if location.BlockNumber >= height {
+		return nil, ErrNotFound
+	}
+
+	b, err := GetBlockByNumber(bc.Store, location.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TxnReceipt{
+		Transaction:   b.Transactions[location.Index],
+		Block:         b,
+		BlockHash:     b.Hash(),
+		Index:         location.Index,
+		Confirmations: height - location.BlockNumber,
+	}, nil
+}
+
+// GetAddressTxns returns up to limit statement lines of address, oldest
+// first or newest first when reverse is set. The page starts right after
+// cursor, or at the beginning of the statement when cursor is empty.
+func (bc *BlockchainStruct) GetAddressTxns(address string, cursor string, limit int, reverse bool) (*AddressTxnPage, error) {
+	if limit <= 0 || limit > constants.ADDRESS_TXNS_MAX_LIMIT {
+		limit = constants.ADDRESS_TXNS_PAGE_LIMIT
+	}
+
+	prefix := addressTxnPrefix(address)
+	var start []byte
+	if cursor != "" {
+		start = append(addressTxnPrefix(address), cursor...)
+	}
+
+	page := &AddressTxnPage{Address: address, Transactions: []*AddressTxn{}}
+	var decodeErr error
+	err := bc.Store.Iterate(prefix, start, reverse, func(key, value []byte) bool {
+		if start != nil && bytes.Equal(key, start) {
+			return true
+		}
+		if len(page.Transactions) == limit {
+			page.NextCursor = page.Transactions[limit-1].Cursor
+			return false
+		}
+
+		var entry AddressTxn
+		if decodeErr = json.Unmarshal(value, &entry); decodeErr != nil {
+			return false
+		}
+		page.Transactions = append(page.Transactions, &entry)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	return page, nil
+}
@@ -0,0 +1,225 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+func TestTxnIndexFollowsReorg(t *testing.T) {
+	store := NewMemoryStore()
+	bc := NewBlockchain(store, *NewBlock("0x0", 0, 0), "", nil, nil)
+
+	txn := NewTransaction("alice", "bob", 10, []byte{})
+	ours := NewBlock(bc.Blocks[0].Hash(), 0, 1)
+	ours.Transactions = append(ours.Transactions, txn)
+	bc.AddBlock(ours)
+
+	location, err := GetTxnLocation(store, txn.Hash())
+	if err != nil || location.BlockNumber != 1 || location.Index != 0 {
+		t.Fatalf("Expected txn at block 1 index 0 but got %+v (%v)", location, err)
+	}
+
+	// a competing chain that includes the same txn one block later
+	theirs1 := NewBlock(bc.Blocks[0].Hash(), 7, 1)
+	theirs2 := NewBlock(theirs1.Hash(), 0, 2)
+	theirs2.Transactions = append(theirs2.Transactions, NewTransaction("carol", "dave", 5, []byte{}), txn)
+	if err := PutChain(store, []*Block{bc.Blocks[0], theirs1, theirs2}); err != nil {
+		t.Fatal(err)
+	}
+
+	location, err = GetTxnLocation(store, txn.Hash())
+	if err != nil || location.BlockNumber != 2 || location.Index != 1 {
+		t.Fatalf("Expected txn at block 2 index 1 after reorg but got %+v (%v)", location, err)
+	}
+	if _, err := GetBlockByHash(store, ours.Hash()); err != ErrNotFound {
+		t.Errorf("Expected the orphaned block to be dropped, got %v", err)
+	}
+}
+
+func TestAddressTxnsPaging(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			bc := NewBlockchain(store, *NewBlock("0x0", 0, 0), "", nil, nil)
+
+			for i := 1; i <= 3; i++ {
+				b := NewBlock(bc.Blocks[len(bc.Blocks)-1].Hash(), 0, uint64(i))
+				reward := NewTransaction(constants.BLOCKCHAIN_ADDRESS, "alice", 100, []byte{})
+				reward.Status = constants.SUCCESS
+				spend := NewTransaction("alice", "bob", 30, []byte{})
+				spend.Status = constants.SUCCESS
+				b.Transactions = append(b.Transactions, reward, spend)
+				bc.AddBlock(b)
+			}
+
+			page, err := bc.GetAddressTxns("alice", "", 4, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Transactions) != 4 || page.NextCursor == "" {
+				t.Fatalf("Expected a full first page with a cursor, got %d lines and cursor %q", len(page.Transactions), page.NextCursor)
+			}
+			if page.Transactions[0].Balance != 210 {
+				t.Errorf("Expected newest running balance 210 but got %d", page.Transactions[0].Balance)
+			}
+
+			rest, err := bc.GetAddressTxns("alice", page.NextCursor, 4, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rest.Transactions) != 2 || rest.NextCursor != "" {
+				t.Fatalf("Expected 2 remaining lines and no cursor, got %d and %q", len(rest.Transactions), rest.NextCursor)
+			}
+			if rest.Transactions[1].Balance != 100 {
+				t.Errorf("Expected oldest running balance 100 but got %d", rest.Transactions[1].Balance)
+			}
+		})
+	}
+}
+
+func TestAccountStateRollsBack(t *testing.T) {
+	store := NewMemoryStore()
+	bc := NewBlockchain(store, *NewBlock("0x0", 0, 0), "", nil, nil)
+
+	reward := NewTransaction(constants.BLOCKCHAIN_ADDRESS, "alice", 100, []byte{})
+	reward.Status = constants.SUCCESS
+	spend := NewTransaction("alice", "bob", 40, []byte{})
+	spend.Status = constants.SUCCESS
+	b1 := NewBlock(bc.Blocks[0].Hash(), 0, 1)
+	b1.Transactions = append(b1.Transactions, reward)
+	bc.AddBlock(b1)
+	b2 := NewBlock(b1.Hash(), 0, 2)
+	b2.Transactions = append(b2.Transactions, spend)
+	bc.AddBlock(b2)
+
+	alice, _ := bc.GetAccount("alice")
+	if alice.Balance != 60 || alice.Nonce != 1 {
+		t.Fatalf("Expected alice at 60/1 but got %+v", alice)
+	}
+
+	if err := PutChain(store, bc.Blocks[:2]); err != nil {
+		t.Fatal(err)
+	}
+	alice, _ = bc.GetAccount("alice")
+	bob, _ := bc.GetAccount("bob")
+	if alice.Balance != 100 || alice.Nonce != 0 || bob.Balance != 0 {
+		t.Errorf("Expected the spend to be rolled back, got alice %+v bob %+v", alice, bob)
+	}
+
+	overdraft := NewBlock(b1.Hash(), 0, 2)
+	tooMuch := NewTransaction("alice", "bob", 101, []byte{})
+	tooMuch.Status = constants.SUCCESS
+	overdraft.Transactions = append(overdraft.Transactions, tooMuch)
+	if err := bc.checkBlockState(overdraft); err == nil {
+		t.Error("Expected an overdraft to be reported")
+	}
+}
+
+func TestReindexClampsLegacyOverdraft(t *testing.T) {
+	genesis := NewBlock("0x0", 0, 0)
+	reward := NewTransaction(constants.BLOCKCHAIN_ADDRESS, "alice", 100, []byte{})
+	reward.Status = constants.SUCCESS
+	b1 := NewBlock(genesis.Hash(), 0, 1)
+	b1.Transactions = append(b1.Transactions, reward)
+
+	// blocks from before balances were checked could spend more than the
+	// sender had
+	spend := NewTransaction("alice", "bob", 150, []byte{})
+	spend.Status = constants.SUCCESS
+	b2 := NewBlock(b1.Hash(), 0, 2)
+	b2.Transactions = append(b2.Transactions, spend)
+	chain := []*Block{genesis, b1, b2}
+
+	store := NewMemoryStore()
+	if err := reindexChain(store, chain); err != nil {
+		t.Fatal(err)
+	}
+	alice, _ := GetAccount(store, "alice")
+	bob, _ := GetAccount(store, "bob")
+	if alice.Balance != 0 || alice.Nonce != 1 || bob.Balance != 100 {
+		t.Errorf("Expected alice left at 0/1 and bob paid the 100 she had, got alice %+v bob %+v", alice, bob)
+	}
+
+	var insufficient *InsufficientBalanceError
+	if err := PutChain(NewMemoryStore(), chain); !errors.As(err, &insufficient) {
+		t.Errorf("Expected an overdraft outside a reindex to fail, got %v", err)
+	}
+}
+
+func TestReorgRevertsClampedOverdraft(t *testing.T) {
+	genesis := NewBlock("0x0", 0, 0)
+	reward := NewTransaction(constants.BLOCKCHAIN_ADDRESS, "alice", 100, []byte{})
+	reward.Status = constants.SUCCESS
+	b1 := NewBlock(genesis.Hash(), 0, 1)
+	b1.Transactions = append(b1.Transactions, reward)
+	spend := NewTransaction("alice", "bob", 150, []byte{})
+	spend.Fee = 10
+	spend.Status = constants.SUCCESS
+	b2 := NewBlock(b1.Hash(), 0, 2)
+	b2.Transactions = append(b2.Transactions, spend)
+
+	// a store an older node wrote: block 2 is there, but the indexes are
+	// not current, so they are rebuilt on start
+	store := NewMemoryStore()
+	if err := PutChain(store, []*Block{genesis, b1}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(b2)
+	batch := NewStoreBatch()
+	batch.Put(blockNumberKey(2), data)
+	batch.Put(blockHashKey(b2.Hash()), []byte("2"))
+	batch.Put([]byte(constants.BLOCKCHAIN_HEAD_KEY), []byte(b2.Hash()))
+	batch.Delete([]byte(constants.CHAIN_INDEX_VERSION_KEY))
+	if err := store.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	bc := NewBlockchain(store, *genesis, "", nil, nil)
+	if alice, _ := bc.GetAccount("alice"); len(bc.Blocks) != 3 || alice.Balance != 0 {
+		t.Fatalf("Expected the overdraft to be clamped on start, got %d blocks and alice %+v", len(bc.Blocks), alice)
+	}
+
+	// undoing the overdraft gives back what it took, not what it asked for
+	theirs2 := NewBlock(b1.Hash(), 7, 2)
+	theirs3 := NewBlock(theirs2.Hash(), 0, 3)
+	if err := bc.SwitchChain([]*Block{b1, theirs2, theirs3}); err != nil {
+		t.Fatal(err)
+	}
+	alice, _ := bc.GetAccount("alice")
+	bob, _ := bc.GetAccount("bob")
+	if alice.Balance != 100 || alice.Nonce != 0 || bob.Balance != 0 {
+		t.Errorf("Expected alice back at 100/0 and bob at 0, got alice %+v bob %+v", alice, bob)
+	}
+	if _, err := store.Get(clampedDebitKey(spend.Hash())); err != ErrNotFound {
+		t.Errorf("Expected the record of the clamped debit to go with its block, got %v", err)
+	}
+}
+
+func TestGetTransactionByHashConfirmations(t *testing.T) {
+	store := NewMemoryStore()
+	bc := NewBlockchain(store, *NewBlock("0x0", 0, 0), "", nil, nil)
+	txn := NewTransaction(constants.BLOCKCHAIN_ADDRESS, "alice", 10, []byte{})
+	txn.Status = constants.SUCCESS
+	b1 := NewBlock(bc.Blocks[0].Hash(), 0, 1)
+	b1.Transactions = append(b1.Transactions, txn)
+	bc.AddBlock(b1)
+	bc.AddBlock(NewBlock(b1.Hash(), 0, 2))
+
+	receipt, err := bc.GetTransactionByHash(txn.Hash())
+	if err != nil || receipt.Confirmations != 2 || receipt.BlockHash != b1.Hash() {
+		t.Fatalf("Expected 2 confirmations in block 1, got %+v (%v)", receipt, err)
+	}
+
+	// the store runs ahead of the chain in memory while a reorg writes it
+	ahead := NewTransaction(constants.BLOCKCHAIN_ADDRESS, "bob", 10, []byte{})
+	ahead.Status = constants.SUCCESS
+	b3 := NewBlock(bc.Blocks[2].Hash(), 0, 3)
+	b3.Transactions = append(b3.Transactions, ahead)
+	if err := PutBlock(store, b3); err != nil {
+		t.Fatal(err)
+	}
+	if receipt, err := bc.GetTransactionByHash(ahead.Hash()); err != ErrNotFound {
+		t.Errorf("Expected a transaction above our head not to be found, got %+v (%v)", receipt, err)
+	}
+}
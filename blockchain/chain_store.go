@@ -0,0 +1,51 @@
+package blockchain
+
+import "errors"
+
+// ErrNotFound is returned by a ChainStore when a key does not exist.
+var ErrNotFound = errors.New("chain store: key not found")
+
+// ChainStore is the key/value store backing a BlockchainStruct. A store is
+// opened once and kept for the lifetime of the blockchain, so the miner and
+// the HTTP handlers share the same handle.
+type ChainStore interface {
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) (bool, error)
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+	// Write applies every operation in the batch atomically.
+	Write(batch *StoreBatch) error
+	// Iterate calls fn for every key that starts with prefix, in ascending
+	// key order or descending when reverse is set, until fn returns false.
+	// A non-nil start skips the keys before it (after it when reversed).
+	// key and value are only valid until fn returns.
+	Iterate(prefix []byte, start []byte, reverse bool, fn func(key, value []byte) bool) error
+	Close() error
+}
+
+type batchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// StoreBatch collects writes that a ChainStore applies together.
+type StoreBatch struct {
+	ops []batchOp
+}
+
+func NewStoreBatch() *StoreBatch {
+	return new(StoreBatch)
+}
+
+func (sb *StoreBatch) Put(key []byte, value []byte) {
+	sb.ops = append(sb.ops, batchOp{key: key, value: value})
+}
+
+func (sb *StoreBatch) Delete(key []byte) {
+	sb.ops = append(sb.ops, batchOp{key: key, delete: true})
+}
+
+func (sb *StoreBatch) Len() int {
+	return len(sb.ops)
+}
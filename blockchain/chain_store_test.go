@@ -0,0 +1,125 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+func testStores(t *testing.T) map[string]ChainStore {
+	levelStore, err := NewLevelDBStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open leveldb store: %v", err)
+	}
+	t.Cleanup(func() { levelStore.Close() })
+
+	return map[string]ChainStore{
+		"memory":  NewMemoryStore(),
+		"leveldb": levelStore,
+	}
+}
+
+func TestChainStoreReadWrite(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := store.Get([]byte("missing")); err != ErrNotFound {
+				t.Fatalf("Expected ErrNotFound but got %v", err)
+			}
+
+			if err := store.Put([]byte("a"), []byte("1")); err != nil {
+				t.Fatal(err)
+			}
+			batch := NewStoreBatch()
+			batch.Put([]byte("b"), []byte("2"))
+			batch.Delete([]byte("a"))
+			if err := store.Write(batch); err != nil {
+				t.Fatal(err)
+			}
+
+			if ok, _ := store.Has([]byte("a")); ok {
+				t.Error("Expected key a to be deleted by the batch")
+			}
+			value, err := store.Get([]byte("b"))
+			if err != nil || !bytes.Equal(value, []byte("2")) {
+				t.Errorf("Expected b=2 but got %q (%v)", value, err)
+			}
+		})
+	}
+}
+
+func TestNewBlockchainReloadsBlocks(t *testing.T) {
+	store := NewMemoryStore()
+	bc := NewBlockchain(store, *NewBlock("0x0", 0, 0), "", nil, nil)
+
+	next := NewBlock(bc.Blocks[0].Hash(), 0, 1)
+	bc.AddBlock(next)
+
+	reloaded := NewBlockchain(store, *NewBlock("0x0", 0, 0), "", nil, nil)
+	if len(reloaded.Blocks) != 2 {
+		t.Fatalf("Expected 2 blocks after reload but got %d", len(reloaded.Blocks))
+	}
+	if reloaded.Blocks[1].Hash() != next.Hash() {
+		t.Errorf("Reloaded head %s does not match %s", reloaded.Blocks[1].Hash(), next.Hash())
+	}
+
+	byHash, err := GetBlockByHash(store, next.Hash())
+	if err != nil || byHash.BlockNumber != 1 {
+		t.Errorf("Expected to find block 1 by hash, got %v (%v)", byHash, err)
+	}
+}
+
+func TestNewBlockchainReopensStore(t *testing.T) {
+	dir := t.TempDir()
+	reopen := func() (ChainStore, *BlockchainStruct) {
+		store, err := NewLevelDBStore(dir)
+		if err != nil {
+			t.Fatalf("Failed to open leveldb store: %v", err)
+		}
+		return store, NewBlockchain(store, *testGenesis(), "", nil, nil)
+	}
+
+	alice := newTestKey(t)
+	store, bc := reopen()
+	fund(bc, alice.address, 100)
+	prev := bc.Blocks[len(bc.Blocks)-1]
+	spend := NewBlock(prev.Hash(), 0, prev.BlockNumber+1)
+	spend.Bits = prev.Bits
+	spend.Transactions = append(spend.Transactions, alice.sign(t, "bob", 40, 1, 0))
+	spend.SetMerkleRoot()
+	bc.AddBlock(spend)
+	want := bc.Blocks
+	store.Close()
+
+	store, reopened := reopen()
+	if len(reopened.Blocks) != len(want) {
+		t.Fatalf("Expected %d blocks after reopening but got %d", len(want), len(reopened.Blocks))
+	}
+	for i, b := range reopened.Blocks {
+		if b.Hash() != want[i].Hash() {
+			t.Errorf("Block %d reopened as %s, expected %s", i, b.Hash(), want[i].Hash())
+		}
+	}
+	head, err := store.Get([]byte(constants.BLOCKCHAIN_HEAD_KEY))
+	if err != nil || string(head) != spend.Hash() {
+		t.Errorf("Expected the head pointer at %s but got %q (%v)", spend.Hash(), head, err)
+	}
+	if account, err := reopened.GetAccount(alice.address); err != nil || account.Balance != 59 || account.Nonce != 1 {
+		t.Errorf("Expected alice at balance 59, nonce 1 after reopening, got %+v (%v)", account, err)
+	}
+
+	// a block added after reopening moves the head on, and the next open
+	// loads it too
+	fund(reopened, "bob", 1)
+	next := reopened.Blocks[len(reopened.Blocks)-1]
+	store.Close()
+
+	store, again := reopen()
+	defer store.Close()
+	if len(again.Blocks) != len(want)+1 || again.Blocks[len(again.Blocks)-1].Hash() != next.Hash() {
+		t.Errorf("Expected %d blocks ending in %s, got %d", len(want)+1, next.Hash(), len(again.Blocks))
+	}
+	if head, _ := store.Get([]byte(constants.BLOCKCHAIN_HEAD_KEY)); string(head) != next.Hash() {
+		t.Errorf("Expected the head pointer at %s but got %q", next.Hash(), head)
+	}
+}
@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+// Every block has its chain work stored under CHAIN_WORK_PREFIX + its hash:
+// the summed Work of the block and all blocks before it, as a decimal
+// string. Fork choice follows the chain with the most work.
+
+// creditedWork is the work b adds to its chain. The genesis block is fixed
+// rather than mined, so its proof of work is never checked and it adds
+// none, whatever Bits it claims.
+func creditedWork(b *Block) *big.Int {
+	if b.BlockNumber == 0 {
+		return new(big.Int)
+	}
+	return b.Work()
+}
+
+func chainWorkKey(hash string) []byte {
+	return []byte(constants.CHAIN_WORK_PREFIX + hash)
+}
+
+// GetChainWork returns the chain work of the block with the given hash.
+func GetChainWork(store ChainStore, hash string) (*big.Int, error) {
+	data, err := store.Get(chainWorkKey(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	work, ok := new(big.Int).SetString(string(data), 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid chain work %q for block %s", data, hash)
+	}
+	return work, nil
+}
+
+// parentWork returns the chain work of the block below b in our chain,
+// looking at the blocks written earlier in the same batch before the store.
+func (ix *chainIndexer) parentWork(b *Block) (*big.Int, error) {
+	if b.BlockNumber == 0 {
+		return new(big.Int), nil
+	}
+	if work, ok := ix.work[b.BlockNumber-1]; ok {
+		return work, nil
+	}
+	parent, err := GetBlockByNumber(ix.store, b.BlockNumber-1)
+	if err != nil {
+		return nil, err
+	}
+	return GetChainWork(ix.store, parent.Hash())
+}
+
+func (ix *chainIndexer) putChainWork(b *Block) error {
+	parent, err := ix.parentWork(b)
+	if err != nil {
+		return err
+	}
+
+	work := new(big.Int).Add(parent, creditedWork(b))
+	ix.work[b.BlockNumber] = work
+	ix.batch.Put(chainWorkKey(b.Hash()), []byte(work.String()))
+	return nil
+}
+
+// ChainWork returns the chain work of our head block.
+func (bc *BlockchainStruct) ChainWork() (*big.Int, error) {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+
+	return bc.chainWork()
+}
+
+func (bc *BlockchainStruct) chainWork() (*big.Int, error) {
+	return GetChainWork(bc.Store, bc.Blocks[len(bc.Blocks)-1].Hash())
+}
+
+// BranchWork returns the chain work blocks would give our chain once
+// switched to: the work of our block they build on plus their own. A
+// segment that brings nothing new is worth our current chain work.
+func (bc *BlockchainStruct) BranchWork(blocks []*Block) (*big.Int, error) {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+
+	return bc.branchWork(blocks)
+}
+
+func (bc *BlockchainStruct) branchWork(blocks []*Block) (*big.Int, error) {
+	shared, err := bc.forkPoint(blocks)
+	if err != nil {
+		return nil, err
+	}
+	if shared == len(blocks) {
+		return bc.chainWork()
+	}
+
+	work := new(big.Int)
+	if fork := blocks[shared].BlockNumber; fork > 0 {
+		work, err = GetChainWork(bc.Store, bc.Blocks[fork-1].Hash())
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, b := range blocks[shared:] {
+		work.Add(work, creditedWork(b))
+	}
+	return work, nil
+}
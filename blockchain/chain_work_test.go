@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestChainWorkFollowsBranches(t *testing.T) {
+	store := NewMemoryStore()
+	bc := NewBlockchain(store, *NewBlock("0x0", 0, 0), "", nil, nil)
+	b1 := NewBlock(bc.Blocks[0].Hash(), 0, 1)
+	bc.AddBlock(b1)
+	b2 := NewBlock(b1.Hash(), 0, 2)
+	bc.AddBlock(b2)
+
+	blockWork := b1.Work()
+	times := func(n int64) *big.Int {
+		return new(big.Int).Mul(blockWork, big.NewInt(n))
+	}
+
+	// the genesis block is not mined and adds no work
+	work, err := bc.ChainWork()
+	if err != nil || work.Cmp(times(2)) != 0 {
+		t.Fatalf("Expected chain work %s but got %v (%v)", times(2), work, err)
+	}
+
+	// a rival for block 2 only ties with us
+	rival := NewBlock(b1.Hash(), 9, 2)
+	if work, _ := bc.BranchWork([]*Block{rival}); work.Cmp(times(2)) != 0 {
+		t.Errorf("Expected the rival to tie at %s but got %s", times(2), work)
+	}
+
+	heavier2 := NewBlock(b1.Hash(), 7, 2)
+	heavier3 := NewBlock(heavier2.Hash(), 0, 3)
+	branch := []*Block{b1, heavier2, heavier3}
+	if work, _ := bc.BranchWork(branch); work.Cmp(times(3)) != 0 {
+		t.Errorf("Expected the longer branch to be worth %s but got %s", times(3), work)
+	}
+
+	if err := bc.SwitchChain(branch); err != nil {
+		t.Fatal(err)
+	}
+	if work, err := bc.ChainWork(); err != nil || work.Cmp(times(3)) != 0 {
+		t.Errorf("Expected chain work %s after the switch but got %v (%v)", times(3), work, err)
+	}
+	if _, err := GetChainWork(store, b2.Hash()); err != ErrNotFound {
+		t.Errorf("Expected the orphaned block's chain work to be dropped, got %v", err)
+	}
+}
+
+func TestForeignGenesisIsRefused(t *testing.T) {
+	bc := NewBlockchain(NewMemoryStore(), *GenesisBlock(), "", nil, nil)
+
+	// a genesis block is never mined, so one claiming the easiest target
+	// there is must not buy a chain all the work it implies
+	fake := NewBlock("0x0", 0, 0)
+	fake.Bits = 0x03000001
+	fake.SetMerkleRoot()
+	next := nextBlock(t, fake, "miner", false)
+	chain := []*Block{fake, next}
+
+	if err := bc.ValidateChainSegment(chain); err != ErrForeignGenesis {
+		t.Errorf("Expected a chain from another genesis block to be refused, got %v", err)
+	}
+	if _, err := bc.BranchWork(chain); err != ErrForeignGenesis {
+		t.Errorf("Expected no work for a chain from another genesis block, got %v", err)
+	}
+	if err := bc.SwitchToHeavier(chain); err != ErrForeignGenesis {
+		t.Errorf("Expected not to switch to a chain from another genesis block, got %v", err)
+	}
+	if len(bc.Blocks) != 1 || bc.Blocks[0].Hash() != GenesisBlock().Hash() {
+		t.Errorf("Expected to stay on our genesis block")
+	}
+}
+
+func TestSwitchToHeavier(t *testing.T) {
+	bc := NewBlockchain(NewMemoryStore(), *testGenesis(), "", nil, nil)
+	genesis := bc.Blocks[0]
+	b1 := nextBlock(t, genesis, "miner", true)
+	bc.AddBlock(b1)
+
+	// a rival for block 1 only ties with us
+	rival := nextBlock(t, genesis, "rival", true)
+	if err := bc.SwitchToHeavier([]*Block{genesis, rival}); err != ErrNotHeavier {
+		t.Errorf("Expected a branch of equal work to be refused, got %v", err)
+	}
+	if bc.Blocks[1].Hash() != b1.Hash() {
+		t.Fatal("Expected to keep our block 1")
+	}
+
+	unmined := nextBlock(t, rival, "rival", false)
+	for meetsProofOfWork(unmined.Hash(), unmined.Target()) {
+		unmined.Nonce++
+	}
+	if err := bc.SwitchToHeavier([]*Block{rival, unmined}); err == nil || err == ErrNotHeavier {
+		t.Errorf("Expected a heavier branch that does not validate to be refused, got %v", err)
+	}
+
+	rival2 := nextBlock(t, rival, "rival", true)
+	if err := bc.SwitchToHeavier([]*Block{rival, rival2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(bc.Blocks) != 3 || bc.Blocks[2].Hash() != rival2.Hash() {
+		t.Errorf("Expected to be on the heavier branch, got %d blocks", len(bc.Blocks))
+	}
+}
@@ -15,6 +15,7 @@ import (
 type ConsensusManager struct {
 	Blockchain  *BlockchainStruct        // Direct pointer to the blockchain
 	PeerManager *peerManager.PeerManager // Direct pointer to the peer manager
+	firstSeen   map[string]time.Time     // when each peer head was first seen
 }
 
 // NewConsensusManager creates a new ConsensusManager.
@@ -22,9 +23,19 @@ func NewConsensusManager(blockchain *BlockchainStruct, peerManager *peerManager.
 	return &ConsensusManager{
 		Blockchain:  blockchain,
 		PeerManager: peerManager,
+		firstSeen:   map[string]time.Time{},
 	}
 }
 
+// seen returns when the head block with the given hash was first seen.
+func (cm *ConsensusManager) seen(hash string) time.Time {
+	if at, ok := cm.firstSeen[hash]; ok {
+		return at
+	}
+	cm.firstSeen[hash] = time.Now()
+	return cm.firstSeen[hash]
+}
+
 var pm *peerManager.PeerManager
 var once sync.Once
 
@@ -51,90 +62,104 @@ func GetPeerManager(blockAdded <-chan events.BlockAddedEvent, transactionAdded <
 // RunConsensus runs the blockchain consensus algorithm.
 func (cm *ConsensusManager) RunConsensus(startMining chan bool) {
 	for {
-		if cm.Blockchain.MiningLocked {
-			time.Sleep(constants.CONSENSUS_PAUSE_TIME * time.Second)
-			continue
+		if !cm.Blockchain.IsMiningLocked() {
+			cm.round(startMining)
 		}
+		time.Sleep(constants.CONSENSUS_PAUSE_TIME * time.Second)
+	}
+}
 
-		log.Println("Starting the consensus algorithm...")
-
-		longestChain := cm.Blockchain.Blocks
-		longestChainIsOurs := true
-
-		// Fetch the last N blocks from each peer
-
-		for peer, status := range cm.PeerManager.Peers {
-
-			if peer != cm.PeerManager.Address && status.Status {
-
-				remotePeerManager, err := peerManager.FetchLastNBlocks(peer)
-
-				if err != nil {
-					log.Println("Error fetching blocks:", err)
-					continue
-				}
-				// Access remotePeerManager.Blocks
-				if len(remotePeerManager.Blocks) > 0 && (len(longestChain) == 0 || remotePeerManager.Blocks[len(remotePeerManager.Blocks)-1].BlockNumber > longestChain[len(longestChain)-1].BlockNumber) {
-					if cm.PeerManager.VerifyLastNBlocks(remotePeerManager.Blocks) {
-						longestChain = make([]*Block, len(remotePeerManager.Blocks))
-						for i, rb := range remotePeerManager.Blocks {
-							block := &Block{
-								BlockNumber: rb.BlockNumber,
-								Nonce:       rb.Nonce,
-								PrevHash:    rb.PrevHash,
-								Timestamp:   rb.Timestamp,
-							}
-							longestChain[i] = block
-
-						}
-
-						longestChainIsOurs = false
-					} else {
-						log.Println("Chain verification failed from peer:", peer)
-					}
+// round fetches the head of every peer's chain and switches ours to the
+// heaviest of them if it outweighs ours.
+func (cm *ConsensusManager) round(startMining chan bool) {
+	log.Println("Starting the consensus algorithm...")
+
+	// the chain with the most work wins; on equal work the one seen
+	// first stays, which is ours over any peer's
+	var heaviestChain []*Block
+	heaviestWork, err := cm.Blockchain.ChainWork()
+	if err != nil {
+		log.Println("Error reading our chain work:", err)
+		return
+	}
+	var heaviestSeen time.Time
+
+	// only heads peers still serve are remembered
+	heads := map[string]bool{}
+	defer func() {
+		for hash := range cm.firstSeen {
+			if !heads[hash] {
+				delete(cm.firstSeen, hash)
+			}
+		}
+	}()
 
-				}
+	// Fetch the last N blocks from each peer
+	for peer, status := range cm.PeerManager.Peers {
+		if peer == cm.PeerManager.Address || !status.Status {
+			continue
+		}
 
-			}
+		remotePeerManager, err := peerManager.FetchLastNBlocks(peer)
+		if err != nil {
+			log.Println("Error fetching blocks:", err)
+			continue
 		}
+		if len(remotePeerManager.Blocks) == 0 {
+			continue
+		}
+		candidate, err := BlocksFromRemote(remotePeerManager.Blocks)
+		if err != nil {
+			log.Println("Error decoding blocks from peer:", peer, err)
+			continue
+		}
+		head := candidate[len(candidate)-1].Hash()
+		heads[head] = true
 
-		if !longestChainIsOurs {
-			cm.Blockchain.Mutex.Lock()
-			defer cm.Blockchain.Mutex.Unlock()
-			//Deep Copy
-			newBlocks := make([]*Block, len(longestChain))
-			for i, b := range longestChain {
-				newBlocks[i] = &Block{ // Copy individual fields (or implement a DeepCopy method for Block)
-					BlockNumber:  b.BlockNumber,
-					Nonce:        b.Nonce,
-					PrevHash:     b.PrevHash,
-					Timestamp:    b.Timestamp,
-					Transactions: b.Transactions,
-				}
+		if err := cm.Blockchain.ValidateChainSegment(candidate); err != nil {
+			log.Println("Chain verification failed from peer:", peer, err)
+			continue
+		}
+		work, err := cm.Blockchain.BranchWork(candidate)
+		if err != nil {
+			log.Println("Chain from peer", peer, "does not fit ours:", err)
+			continue
+		}
+		headSeen := cm.seen(head)
+		switch work.Cmp(heaviestWork) {
+		case -1:
+			continue
+		case 0:
+			if heaviestChain == nil || !headSeen.Before(heaviestSeen) {
+				continue
 			}
+		}
 
-			cm.Blockchain.Blocks = newBlocks
-			cm.Blockchain.MiningLocked = true
-			startMining <- true
+		heaviestChain = candidate
+		heaviestWork = work
+		heaviestSeen = headSeen
+	}
 
-			err := PutIntoDb(cm.Blockchain) // Save to DB after successful update
-			if err != nil {
-				log.Printf("Failed to save updated blockchain to DB: %s", err) // Log and continue, consensus will retry
-			} else {
-				log.Println("Updated our blockchain to the longest chain")
-				//for _, b := range cm.Blockchain.Blocks {
-				//for _, txn := range b.Transactions {
-				//cm.PeerManager.Broadcaster.BroadcastTransaction(txn, cm.PeerManager.Address)
+	if heaviestChain == nil {
+		return
+	}
 
-				//	}
-			}
-		}
+	cm.Blockchain.SetMiningLocked(true)
+	select {
+	case startMining <- true:
+	default:
+	}
 
-		// After updating blockchain and before sending a block added event.
-		cm.Blockchain.MiningLocked = false
-	} // else {
-	// log.Println("Our chain is the longest chain")
-	// }
+	// our chain may have grown since the peers were compared with it, so
+	// SwitchToHeavier checks the work again under the lock it switches
+	// under; it reverts our blocks down to the common ancestor and puts
+	// their transactions back in the mempool
+	if err := cm.Blockchain.SwitchToHeavier(heaviestChain); err != nil {
+		log.Printf("Failed to switch to the heaviest chain: %s", err) // Log and continue, consensus will retry
+	} else {
+		log.Printf("Updated our blockchain to the heaviest chain, total work %s", heaviestWork)
+	}
 
-	time.Sleep(constants.CONSENSUS_PAUSE_TIME * time.Second)
+	// After updating blockchain and before sending a block added event.
+	cm.Blockchain.SetMiningLocked(false)
 }
@@ -3,37 +3,184 @@ package blockchain
 import (
 	"KNIRVCHAIN-MAIN/constants"
 	"encoding/json"
-
-	"github.com/syndtr/goleveldb/leveldb"
+	"fmt"
+	"strconv"
 )
 
-func PutIntoDb(bs *BlockchainStruct) error { // Changed to use pointer
-	db, err := leveldb.OpenFile(constants.BLOCKCHAIN_DB_PATH, nil)
+// Every block is stored once under BLOCK_NUMBER_PREFIX + its zero padded
+// number, with a BLOCK_HASH_PREFIX + hash entry pointing back at the number.
+// BLOCKCHAIN_HEAD_KEY holds the hash of the last block of the chain.
+
+func blockNumberKey(number uint64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", constants.BLOCK_NUMBER_PREFIX, number))
+}
+
+func blockHashKey(hash string) []byte {
+	return []byte(constants.BLOCK_HASH_PREFIX + hash)
+}
+
+func writeBlock(ix *chainIndexer, b *Block) error {
+	value, err := json.Marshal(b)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	hash := b.Hash()
+	ix.batch.Put(blockNumberKey(b.BlockNumber), value)
+	ix.batch.Put(blockHashKey(hash), []byte(strconv.FormatUint(b.BlockNumber, 10)))
+	ix.batch.Put([]byte(constants.BLOCKCHAIN_HEAD_KEY), []byte(hash))
+	return ix.indexBlock(b)
+}
 
-	// save into the database
-	value, err := json.Marshal(bs)
-	if err != nil {
+// dropBlock removes a stored block and its index entries.
+func dropBlock(ix *chainIndexer, b *Block) error {
+	ix.batch.Delete(blockNumberKey(b.BlockNumber))
+	ix.batch.Delete(blockHashKey(b.Hash()))
+	return ix.unindexBlock(b)
+}
+
+// PutBlock stores a single block and moves the head pointer to it.
+func PutBlock(store ChainStore, b *Block) error {
+	batch := NewStoreBatch()
+	if err := writeBlock(newChainIndexer(store, batch), b); err != nil {
 		return err
 	}
-	err = db.Put([]byte(constants.BLOCKCHAIN_KEY), value, nil)
+	return store.Write(batch)
+}
+
+// PutChain replaces the stored chain with blocks. Stored blocks that differ
+// from the new ones, or sit above the new head, are dropped together with
+// their index entries.
+func PutChain(store ChainStore, blocks []*Block) error {
+	return putChainFrom(store, blocks, 0)
+}
+
+// putChainFrom is PutChain for a caller that knows the stored blocks below
+// number fork are blocks[:fork] already, such as a reorg that knows where
+// it forks. Only the blocks from fork up are read and compared.
+func putChainFrom(store ChainStore, blocks []*Block, fork uint64) error {
+	batch := NewStoreBatch()
+	ix := newChainIndexer(store, batch)
+
+	// everything from the first differing block up is dropped before the
+	// new blocks are written, so that index entries of transactions that
+	// moved to another block end up pointing at the new one
+	keep := int(fork)
+	for number := keep; ; number++ {
+		old, err := GetBlockByNumber(store, uint64(number))
+		if err == ErrNotFound {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if number == keep && number < len(blocks) && old.Hash() == blocks[number].Hash() {
+			keep++
+			continue
+		}
+		if err := dropBlock(ix, old); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range blocks[keep:] {
+		if err := writeBlock(ix, b); err != nil {
+			return err
+		}
+	}
+	if len(blocks) > 0 {
+		batch.Put([]byte(constants.BLOCKCHAIN_HEAD_KEY), []byte(blocks[len(blocks)-1].Hash()))
+	}
+
+	return store.Write(batch)
+}
+
+func GetBlockByNumber(store ChainStore, number uint64) (*Block, error) {
+	data, err := store.Get(blockNumberKey(number))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	var b Block
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
 }
 
-func GetBlockchain() (*BlockchainStruct, error) {
-	db, err := leveldb.OpenFile(constants.BLOCKCHAIN_DB_PATH, nil)
+func GetBlockByHash(store ChainStore, hash string) (*Block, error) {
+	data, err := store.Get(blockHashKey(hash))
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
-	data, err := db.Get([]byte(constants.BLOCKCHAIN_KEY), nil)
+	number, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return GetBlockByNumber(store, number)
+}
+
+// GetBlocks loads the chain block by block, from the genesis block up to
+// the block the head pointer refers to.
+func GetBlocks(store ChainStore) ([]*Block, error) {
+	head, err := store.Get([]byte(constants.BLOCKCHAIN_HEAD_KEY))
+	if err != nil {
+		return nil, err
+	}
+	data, err := store.Get(blockHashKey(string(head)))
+	if err != nil {
+		return nil, err
+	}
+	headNumber, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]*Block, 0, headNumber+1)
+	for number := uint64(0); number <= headNumber; number++ {
+		b, err := GetBlockByNumber(store, number)
+		if err != nil {
+			return nil, fmt.Errorf("loading block %d: %w", number, err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	return blocks, nil
+}
+
+func PutTransactionPool(store ChainStore, pool []*Transaction) error {
+	value, err := json.Marshal(pool)
+	if err != nil {
+		return err
+	}
+	return store.Put([]byte(constants.TXN_POOL_KEY), value)
+}
+
+// GetTransactionPool reads the pool saved as a single list under
+// TXN_POOL_KEY. Newer versions keep the mempool journal instead and only read
+// it to take over what an older version left.
+func GetTransactionPool(store ChainStore) ([]*Transaction, error) {
+	pool := []*Transaction{}
+	data, err := store.Get([]byte(constants.TXN_POOL_KEY))
+	if err == ErrNotFound {
+		return pool, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &pool); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+func HeadExists(store ChainStore) (bool, error) {
+	return store.Has([]byte(constants.BLOCKCHAIN_HEAD_KEY))
+}
+
+// GetBlockchain reads a chain saved in the old format, where the whole
+// BlockchainStruct was stored under BLOCKCHAIN_KEY.
+func GetBlockchain(store ChainStore) (*BlockchainStruct, error) {
+	data, err := store.Get([]byte(constants.BLOCKCHAIN_KEY))
 	if err != nil {
 		return nil, err
 	}
@@ -47,13 +194,23 @@ func GetBlockchain() (*BlockchainStruct, error) {
 	return &bc, nil
 }
 
-func KeyExists() (bool, error) {
-	db, err := leveldb.OpenFile(constants.BLOCKCHAIN_DB_PATH, nil)
-	if err != nil {
-		return false, err
+// MigrateLegacyBlockchain rewrites a chain saved in the old format into
+// per-block entries and removes the old value.
+func MigrateLegacyBlockchain(store ChainStore, bc *BlockchainStruct) error {
+	if err := PutChain(store, bc.Blocks); err != nil {
+		return err
+	}
+	pool := []*Transaction{}
+	if bc.Mempool != nil {
+		pool = bc.Mempool.Transactions()
 	}
-	defer db.Close()
+	if err := PutTransactionPool(store, pool); err != nil {
+		return err
+	}
+
+	return store.Delete([]byte(constants.BLOCKCHAIN_KEY))
+}
 
-	exists, err := db.Has([]byte(constants.BLOCKCHAIN_KEY), nil)
-	return exists, err
+func KeyExists(store ChainStore) (bool, error) {
+	return store.Has([]byte(constants.BLOCKCHAIN_KEY))
 }
@@ -0,0 +1,85 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+// Retarget is how the mining target follows the block time. Every Interval
+// blocks the target is scaled by the time the last Interval blocks took
+// over the time BlockTime per block would have taken, so blocks that came
+// too fast make the next ones harder. One retarget moves the target by at
+// most a factor of four either way, and never above POW_LIMIT_BITS. In
+// between blocks keep the target of their parent.
+type Retarget struct {
+	Interval  uint64
+	BlockTime time.Duration
+}
+
+func DefaultRetarget() Retarget {
+	return Retarget{
+		Interval:  constants.RETARGET_INTERVAL,
+		BlockTime: constants.TARGET_BLOCK_TIME * time.Second,
+	}
+}
+
+// NextBits returns the target, in compact form, the block after chain has
+// to carry. chain runs from the genesis block up to the parent of that
+// block.
+func (r Retarget) NextBits(chain []*Block) uint32 {
+	next := uint64(len(chain))
+	parent := chain[next-1]
+	if r.Interval < 2 || r.BlockTime <= 0 || next%r.Interval != 0 {
+		return parent.bits()
+	}
+
+	elapsed := parent.Timestamp - chain[next-r.Interval].Timestamp
+	expected := int64(r.Interval-1) * int64(r.BlockTime)
+	if elapsed < expected/4 {
+		elapsed = expected / 4
+	}
+	if elapsed > expected*4 {
+		elapsed = expected * 4
+	}
+
+	target := new(big.Int).Mul(parent.Target(), big.NewInt(elapsed))
+	target.Div(target, big.NewInt(expected))
+	if limit := powLimit(); target.Cmp(limit) > 0 {
+		target = limit
+	}
+	return TargetToCompact(target)
+}
+
+// checkTimestamp fails unless b, the block after chain, is stamped later
+// than the median time of the last MEDIAN_TIME_SPAN blocks of chain and no
+// more than MAX_FUTURE_BLOCK_TIME after now. The retarget goes by the
+// timestamps, so without both bounds miners could stamp blocks as they
+// please and talk the target up to the limit.
+func checkTimestamp(chain []*Block, b *Block, now time.Time) error {
+	if median := medianTimePast(chain); b.Timestamp <= median {
+		return fmt.Errorf("timestamp %d is not after the median time %d of the blocks before it", b.Timestamp, median)
+	}
+	if latest := now.Add(constants.MAX_FUTURE_BLOCK_TIME * time.Second).UnixNano(); b.Timestamp > latest {
+		return fmt.Errorf("timestamp %d is more than %ds ahead of ours", b.Timestamp, constants.MAX_FUTURE_BLOCK_TIME)
+	}
+	return nil
+}
+
+// medianTimePast is the median timestamp of the last MEDIAN_TIME_SPAN
+// blocks of chain, or of all of them on a shorter chain.
+func medianTimePast(chain []*Block) int64 {
+	start := len(chain) - constants.MEDIAN_TIME_SPAN
+	if start < 0 {
+		start = 0
+	}
+	times := make([]int64, 0, len(chain)-start)
+	for _, b := range chain[start:] {
+		times = append(times, b.Timestamp)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2]
+}
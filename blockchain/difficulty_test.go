@@ -0,0 +1,122 @@
+package blockchain
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+// spacedChain returns a genesis block and n blocks after it, gap apart, all
+// with target bits.
+func spacedChain(n int, gap time.Duration, bits uint32) []*Block {
+	chain := []*Block{NewBlock("0x0", 0, 0)}
+	for i := 1; i <= n; i++ {
+		b := NewBlock(chain[i-1].Hash(), 0, uint64(i))
+		b.Timestamp = chain[0].Timestamp + int64(i)*int64(gap)
+		b.Bits = bits
+		chain = append(chain, b)
+	}
+	return chain
+}
+
+func TestRetargetNextBits(t *testing.T) {
+	r := Retarget{Interval: 4, BlockTime: 10 * time.Second}
+	const bits = 0x1d00ffff
+	scaled := func(num, den int64) uint32 {
+		target := new(big.Int).Mul(CompactToTarget(bits), big.NewInt(num))
+		return TargetToCompact(target.Div(target, big.NewInt(den)))
+	}
+
+	tests := []struct {
+		name   string
+		blocks int
+		gap    time.Duration
+		want   uint32
+	}{
+		{"between retargets", 2, time.Second, bits},
+		{"on time", 3, 10 * time.Second, bits},
+		{"a bit fast", 3, 8 * time.Second, scaled(4, 5)},
+		{"a bit slow", 3, 12 * time.Second, scaled(6, 5)},
+		{"too fast", 3, time.Second, scaled(1, 4)},
+		{"too slow", 3, time.Minute, scaled(4, 1)},
+	}
+	for _, tt := range tests {
+		if got := r.NextBits(spacedChain(tt.blocks, tt.gap, bits)); got != tt.want {
+			t.Errorf("%s: expected bits %08x but got %08x", tt.name, tt.want, got)
+		}
+	}
+
+	limit := spacedChain(3, time.Hour, constants.POW_LIMIT_BITS)
+	if got := r.NextBits(limit); got != constants.POW_LIMIT_BITS {
+		t.Errorf("Expected the target to stay at the limit %08x but got %08x", constants.POW_LIMIT_BITS, got)
+	}
+
+	// blocks from before targets keep the target of their zero digits
+	if got := r.NextBits(spacedChain(1, time.Second, 0)); got != 0x1e0fffff {
+		t.Errorf("Expected legacy blocks to lead to bits 1e0fffff but got %08x", got)
+	}
+}
+
+func TestValidateBlockTarget(t *testing.T) {
+	bc := NewBlockchain(NewMemoryStore(), *NewBlock("0x0", 0, 0), "", nil, nil)
+
+	easy := nextBlock(t, bc.Blocks[0], "miner", false)
+	easy.Bits = constants.POW_LIMIT_BITS
+	if err := easy.Mine(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ValidateBlock(easy); err == nil || !strings.Contains(err.Error(), "target") {
+		t.Errorf("Expected a block with an easier target to be refused, got %v", err)
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	chain := spacedChain(constants.MEDIAN_TIME_SPAN+4, time.Second, testBits)
+	median := chain[len(chain)-1-constants.MEDIAN_TIME_SPAN/2].Timestamp
+	now := time.Unix(0, chain[len(chain)-1].Timestamp)
+	future := int64(constants.MAX_FUTURE_BLOCK_TIME * time.Second)
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		ok        bool
+	}{
+		{"after the parent", chain[len(chain)-1].Timestamp + 1, true},
+		{"before the parent but after the median", median + 1, true},
+		{"at the median", median, false},
+		{"far back", chain[0].Timestamp, false},
+		{"at the future limit", now.UnixNano() + future, true},
+		{"past the future limit", now.UnixNano() + future + 1, false},
+	}
+	for _, tt := range tests {
+		b := NewBlock(chain[len(chain)-1].Hash(), 0, uint64(len(chain)))
+		b.Timestamp = tt.timestamp
+		if err := checkTimestamp(chain, b, now); (err == nil) != tt.ok {
+			t.Errorf("%s: expected ok %v, got %v", tt.name, tt.ok, err)
+		}
+	}
+}
+
+func TestValidateBlockTimestamp(t *testing.T) {
+	bc := NewBlockchain(NewMemoryStore(), *testGenesis(), "", nil, nil)
+	b1 := nextBlock(t, bc.Blocks[0], "miner", true)
+	bc.AddBlock(b1)
+
+	// a miner stamping its block far ahead would make the blocks look
+	// slow and talk the next target up
+	ahead := nextBlock(t, b1, "miner", false)
+	ahead.Timestamp = time.Now().Add(3 * time.Hour).UnixNano()
+	if err := bc.ValidateBlock(ahead); err == nil || !strings.Contains(err.Error(), "timestamp") {
+		t.Errorf("Expected a block stamped hours ahead to be refused, got %v", err)
+	}
+
+	back := nextBlock(t, b1, "miner", false)
+	back.Timestamp = bc.Blocks[0].Timestamp
+	if err := bc.ValidateBlock(back); err == nil || !strings.Contains(err.Error(), "timestamp") {
+		t.Errorf("Expected a block stamped before the median time to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package blockchain
+
+import (
+	"container/heap"
+	"sort"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+// FeeEstimate summarizes the fee rates, in fee per byte of a transaction,
+// paid in the last Blocks blocks of the chain.
+type FeeEstimate struct {
+	Blocks  int     `json:"blocks"`
+	Samples int     `json:"samples"`
+	Low     float64 `json:"low"`
+	Median  float64 `json:"median"`
+	High    float64 `json:"high"`
+}
+
+// senderQueue holds the transactions of one sender in nonce order, with
+// the fee rate of each worked out once.
+type senderQueue struct {
+	seen  int // position of the sender's first transaction in the pool
+	txns  []*Transaction
+	rates []float64
+}
+
+// queueHeap orders sender queues by the fee rate of their next
+// transaction, best paying first and, on equal rates, the sender seen first.
+type queueHeap []*senderQueue
+
+func (h queueHeap) Len() int { return len(h) }
+func (h queueHeap) Less(i, j int) bool {
+	if h[i].rates[0] != h[j].rates[0] {
+		return h[i].rates[0] > h[j].rates[0]
+	}
+	return h[i].seen < h[j].seen
+}
+func (h queueHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *queueHeap) Push(x interface{}) { *h = append(*h, x.(*senderQueue)) }
+func (h *queueHeap) Pop() interface{} {
+	old := *h
+	q := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return q
+}
+
+// orderByFeeRate returns the transactions of pool best paying first. The
+// transactions of one sender keep their nonce order, so a sender's cheap
+// transaction still goes ahead of its own later, better paying ones.
+func orderByFeeRate(pool []*Transaction) []*Transaction {
+	queues := map[string]*senderQueue{}
+	h := queueHeap{}
+	for i, txn := range pool {
+		q, ok := queues[txn.From]
+		if !ok {
+			q = &senderQueue{seen: i}
+			queues[txn.From] = q
+			h = append(h, q)
+		}
+		q.txns = append(q.txns, txn)
+	}
+	for _, q := range h {
+		sort.SliceStable(q.txns, func(i, j int) bool {
+			return q.txns[i].Nonce < q.txns[j].Nonce
+		})
+		q.rates = make([]float64, len(q.txns))
+		for i, txn := range q.txns {
+			q.rates[i] = txn.FeeRate()
+		}
+	}
+	heap.Init(&h)
+
+	ordered := make([]*Transaction, 0, len(pool))
+	for h.Len() > 0 {
+		q := h[0]
+		ordered = append(ordered, q.txns[0])
+		q.txns, q.rates = q.txns[1:], q.rates[1:]
+		if len(q.txns) == 0 {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return ordered
+}
+
+// EstimateFee looks at the fee rates of the transactions in the last
+// FEE_ESTIMATE_BLOCKS blocks. Low, Median and High are the 25th, 50th and
+// 90th percentile. Without any samples every rate is MIN_FEE_PER_BYTE.
+func (bc *BlockchainStruct) EstimateFee() *FeeEstimate {
+	bc.Mutex.Lock()
+	blocks := bc.Blocks
+	if len(blocks) > constants.FEE_ESTIMATE_BLOCKS {
+		blocks = blocks[len(blocks)-constants.FEE_ESTIMATE_BLOCKS:]
+	}
+	blocks = append([]*Block{}, blocks...)
+	bc.Mutex.Unlock()
+
+	rates := []float64{}
+	for _, b := range blocks {
+		for _, txn := range b.Transactions {
+			if txn.From != constants.BLOCKCHAIN_ADDRESS && txn.Status == constants.SUCCESS {
+				rates = append(rates, txn.FeeRate())
+			}
+		}
+	}
+
+	estimate := &FeeEstimate{
+		Blocks:  len(blocks),
+		Samples: len(rates),
+		Low:     constants.MIN_FEE_PER_BYTE,
+		Median:  constants.MIN_FEE_PER_BYTE,
+		High:    constants.MIN_FEE_PER_BYTE,
+	}
+	if len(rates) == 0 {
+		return estimate
+	}
+
+	sort.Float64s(rates)
+	percentile := func(p int) float64 {
+		return rates[(len(rates)-1)*p/100]
+	}
+	estimate.Low = percentile(25)
+	estimate.Median = percentile(50)
+	estimate.High = percentile(90)
+	return estimate
+}
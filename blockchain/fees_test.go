@@ -0,0 +1,97 @@
+package blockchain
+
+import (
+	"testing"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+func TestOrderByFeeRateKeepsNonceOrder(t *testing.T) {
+	feeTxn := func(from string, nonce, fee uint64) *Transaction {
+		txn := NewTransaction(from, "bob", 10, []byte{})
+		txn.Nonce = nonce
+		txn.Fee = fee
+		return txn
+	}
+	aliceCheap := feeTxn("alice", 0, 1)
+	aliceRich := feeTxn("alice", 1, 900)
+	carol := feeTxn("carol", 0, 500)
+
+	ordered := orderByFeeRate([]*Transaction{aliceCheap, aliceRich, carol})
+	want := []*Transaction{carol, aliceCheap, aliceRich}
+	for i := range want {
+		if ordered[i] != want[i] {
+			t.Fatalf("Expected position %d to be %s nonce %d but got %s nonce %d", i, want[i].From, want[i].Nonce, ordered[i].From, ordered[i].Nonce)
+		}
+	}
+
+	// on equal rates the sender seen first goes first
+	erin, dave := feeTxn("erin", 0, 50), feeTxn("dave", 0, 50)
+	if ordered := orderByFeeRate([]*Transaction{erin, dave}); ordered[0] != erin {
+		t.Errorf("Expected erin, seen first, ahead of dave at the same rate")
+	}
+}
+
+func TestFeeIsDebitedFromSender(t *testing.T) {
+	store := NewMemoryStore()
+	bc := NewBlockchain(store, *NewBlock("0x0", 0, 0), "", nil, nil)
+
+	reward := NewTransaction(constants.BLOCKCHAIN_ADDRESS, "alice", 100, []byte{})
+	reward.Status = constants.SUCCESS
+	spend := NewTransaction("alice", "bob", 40, []byte{})
+	spend.Fee = 5
+	spend.Status = constants.SUCCESS
+	b := NewBlock(bc.Blocks[0].Hash(), 0, 1)
+	b.Transactions = append(b.Transactions, reward, spend)
+	bc.AddBlock(b)
+
+	alice, _ := bc.GetAccount("alice")
+	bob, _ := bc.GetAccount("bob")
+	if alice.Balance != 55 || bob.Balance != 40 {
+		t.Errorf("Expected alice 55 and bob 40 but got %d and %d", alice.Balance, bob.Balance)
+	}
+
+	tooMuch := NewTransaction("alice", "bob", 55, []byte{})
+	tooMuch.Nonce = 1
+	tooMuch.Fee = 1
+	tooMuch.Status = constants.SUCCESS
+	next := NewBlock(b.Hash(), 0, 2)
+	next.Transactions = append(next.Transactions, tooMuch)
+	if err := bc.checkBlockState(next); err == nil {
+		t.Error("Expected value plus fee above the balance to be reported")
+	}
+}
+
+func TestEstimateFee(t *testing.T) {
+	bc := NewBlockchain(NewMemoryStore(), *NewBlock("0x0", 0, 0), "", nil, nil)
+	if estimate := bc.EstimateFee(); estimate.Samples != 0 || estimate.Median != constants.MIN_FEE_PER_BYTE {
+		t.Errorf("Expected the minimum rate without samples, got %+v", estimate)
+	}
+
+	fund(bc, "alice", 1000)
+	var rates []float64
+	for i := 1; i <= 3; i++ {
+		txn := pendingTxn("alice", uint64(i-1), uint64(100*i))
+		txn.Status = constants.SUCCESS
+		rates = append(rates, txn.FeeRate())
+		prev := bc.Blocks[len(bc.Blocks)-1]
+		b := NewBlock(prev.Hash(), 0, prev.BlockNumber+1)
+		b.Transactions = append(b.Transactions, txn)
+		bc.AddBlock(b)
+	}
+
+	// blocks keep coming while the estimate is worked out
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			fund(bc, "bob", 1)
+		}
+	}()
+	estimate := bc.EstimateFee()
+	<-done
+
+	if estimate.Samples != 3 || estimate.Low != rates[0] || estimate.Median != rates[1] || estimate.High != rates[1] {
+		t.Errorf("Expected rates %v, got %+v", rates, estimate)
+	}
+}
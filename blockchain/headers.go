@@ -0,0 +1,129 @@
+package blockchain
+
+import (
+	"fmt"
+	"time"
+
+	"KNIRVCHAIN-MAIN/peerManager"
+)
+
+// Header is what headers-first sync fetches of a block before its body:
+// the block header and its hash. Blocks from before Merkle roots hash with
+// their transactions, so only the body can confirm the hash of theirs.
+type Header struct {
+	BlockHeader
+	Hash string `json:"hash"`
+}
+
+func (b Block) Header() Header {
+	return Header{BlockHeader: b.BlockHeader, Hash: b.Hash()}
+}
+
+// BlockRange returns up to count blocks of our chain starting at block
+// number from.
+func (bc *BlockchainStruct) BlockRange(from uint64, count int) []*Block {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+
+	if from >= uint64(len(bc.Blocks)) {
+		return []*Block{}
+	}
+	to := from + uint64(count)
+	if to > uint64(len(bc.Blocks)) {
+		to = uint64(len(bc.Blocks))
+	}
+	return append([]*Block{}, bc.Blocks[from:to]...)
+}
+
+// Headers returns the headers of up to count blocks of our chain starting
+// at block number from.
+func (bc *BlockchainStruct) Headers(from uint64, count int) []Header {
+	blocks := bc.BlockRange(from, count)
+	headers := make([]Header, len(blocks))
+	for i, b := range blocks {
+		headers[i] = b.Header()
+	}
+	return headers
+}
+
+// checkHeaders fails unless headers, a chain from its genesis header up,
+// number on one by one, each links to the hash of the one before, and each
+// but the genesis header carries a Merkle root, a timestamp checkTimestamp
+// accepts, target bits that are the ones r expects, and a hash that is its
+// own and meets them. The genesis
+// header hashes with its body, so its hash is only a claim until the chain
+// is checked against our genesis block.
+func checkHeaders(r Retarget, headers []*peerManager.RemoteHeader) error {
+	c := headerChecker{r: r}
+	return c.add(headers)
+}
+
+// headerChecker runs the checks of checkHeaders on a chain of headers batch
+// by batch as they arrive, so a peer is given up on at its first bad batch
+// rather than after it has sent its whole chain.
+type headerChecker struct {
+	r       Retarget
+	headers []*peerManager.RemoteHeader
+	// retargeting only looks at numbers, timestamps and targets, which the
+	// headers carry
+	chain []*Block
+}
+
+// add checks batch, the headers that follow the ones added so far, and
+// keeps them if they pass.
+func (c *headerChecker) add(batch []*peerManager.RemoteHeader) error {
+	for _, h := range batch {
+		b := &Block{BlockHeader: headerFromRemote(h.RemoteBlockHeader)}
+		if len(c.chain) == 0 {
+			if h.BlockNumber != 0 {
+				return fmt.Errorf("header %d: expected a genesis header", h.BlockNumber)
+			}
+			c.headers = append(c.headers, h)
+			c.chain = append(c.chain, b)
+			continue
+		}
+
+		// without a root the hash would be the one of the whole block,
+		// which a header cannot be checked against, and without bits the
+		// target would be the one blocks had before targets
+		if h.MerkleRoot == "" {
+			return fmt.Errorf("header %d: has no merkle root", h.BlockNumber)
+		}
+		if h.Bits == 0 {
+			return fmt.Errorf("header %d: has no target bits", h.BlockNumber)
+		}
+		if hash := b.Hash(); hash != h.Hash {
+			return fmt.Errorf("header %d: hashes to %s, not %s", h.BlockNumber, hash, h.Hash)
+		}
+		prev := c.headers[len(c.headers)-1]
+		if h.BlockNumber != prev.BlockNumber+1 {
+			return fmt.Errorf("header %d follows header %d", h.BlockNumber, prev.BlockNumber)
+		}
+		if h.PrevHash != prev.Hash {
+			return fmt.Errorf("header %d: previous hash %s does not match header %d", h.BlockNumber, h.PrevHash, prev.BlockNumber)
+		}
+		if err := checkTimestamp(c.chain, b, time.Now()); err != nil {
+			return fmt.Errorf("header %d: %w", h.BlockNumber, err)
+		}
+		if expected := c.r.NextBits(c.chain); h.Bits != expected {
+			return fmt.Errorf("header %d: target bits %08x, expected %08x", h.BlockNumber, h.Bits, expected)
+		}
+		if !meetsProofOfWork(h.Hash, b.Target()) {
+			return fmt.Errorf("header %d: hash %s does not meet the proof of work", h.BlockNumber, h.Hash)
+		}
+		c.headers = append(c.headers, h)
+		c.chain = append(c.chain, b)
+	}
+	return nil
+}
+
+func headerFromRemote(h peerManager.RemoteBlockHeader) BlockHeader {
+	return BlockHeader{
+		BlockNumber: h.BlockNumber,
+		PrevHash:    h.PrevHash,
+		MerkleRoot:  h.MerkleRoot,
+		Timestamp:   h.Timestamp,
+		Nonce:       h.Nonce,
+		Bits:        h.Bits,
+	}
+}
@@ -0,0 +1,100 @@
+package blockchain
+
+import (
+	"bytes"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// LevelDBStore is a ChainStore kept in a LevelDB database on disk.
+type LevelDBStore struct {
+	db *leveldb.DB
+}
+
+func NewLevelDBStore(path string) (*LevelDBStore, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &LevelDBStore{db: db}, nil
+}
+
+func (s *LevelDBStore) Get(key []byte) ([]byte, error) {
+	value, err := s.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (s *LevelDBStore) Has(key []byte) (bool, error) {
+	return s.db.Has(key, nil)
+}
+
+func (s *LevelDBStore) Put(key []byte, value []byte) error {
+	return s.db.Put(key, value, nil)
+}
+
+func (s *LevelDBStore) Delete(key []byte) error {
+	return s.db.Delete(key, nil)
+}
+
+func (s *LevelDBStore) Write(sb *StoreBatch) error {
+	batch := new(leveldb.Batch)
+	for _, op := range sb.ops {
+		if op.delete {
+			batch.Delete(op.key)
+		} else {
+			batch.Put(op.key, op.value)
+		}
+	}
+	return s.db.Write(batch, nil)
+}
+
+func (s *LevelDBStore) Iterate(prefix []byte, start []byte, reverse bool, fn func(key, value []byte) bool) error {
+	it := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer it.Release()
+
+	var ok bool
+	switch {
+	case start == nil && !reverse:
+		ok = it.First()
+	case start == nil && reverse:
+		ok = it.Last()
+	case !reverse:
+		ok = it.Seek(start)
+	default:
+		ok = seekReverse(it, start)
+	}
+
+	for ; ok; ok = iterStep(it, reverse) {
+		if !fn(it.Key(), it.Value()) {
+			break
+		}
+	}
+	return it.Error()
+}
+
+// seekReverse moves it to the last key that is not greater than start.
+func seekReverse(it iterator.Iterator, start []byte) bool {
+	if !it.Seek(start) {
+		return it.Last()
+	}
+	if bytes.Compare(it.Key(), start) > 0 {
+		return it.Prev()
+	}
+	return true
+}
+
+func iterStep(it iterator.Iterator, reverse bool) bool {
+	if reverse {
+		return it.Prev()
+	}
+	return it.Next()
+}
+
+func (s *LevelDBStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryStore is a ChainStore that only lives in memory. It is meant for
+// tests and throwaway nodes.
+type MemoryStore struct {
+	mutex sync.RWMutex
+	data  map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: map[string][]byte{}}
+}
+
+func (s *MemoryStore) Get(key []byte) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	value, ok := s.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (s *MemoryStore) Has(key []byte) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, ok := s.data[string(key)]
+	return ok, nil
+}
+
+func (s *MemoryStore) Put(key []byte, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (s *MemoryStore) Delete(key []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.data, string(key))
+	return nil
+}
+
+func (s *MemoryStore) Write(sb *StoreBatch) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, op := range sb.ops {
+		if op.delete {
+			delete(s.data, string(op.key))
+		} else {
+			s.data[string(op.key)] = append([]byte{}, op.value...)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Iterate(prefix []byte, start []byte, reverse bool, fn func(key, value []byte) bool) error {
+	s.mutex.RLock()
+	keys := []string{}
+	for key := range s.data {
+		if !strings.HasPrefix(key, string(prefix)) {
+			continue
+		}
+		if start != nil {
+			cmp := bytes.Compare([]byte(key), start)
+			if (!reverse && cmp < 0) || (reverse && cmp > 0) {
+				continue
+			}
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = append([]byte{}, s.data[key]...)
+	}
+	s.mutex.RUnlock()
+
+	for i := range keys {
+		j := i
+		if reverse {
+			j = len(keys) - 1 - i
+		}
+		if !fn([]byte(keys[j]), values[j]) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
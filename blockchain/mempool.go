@@ -0,0 +1,460 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+// ErrMempoolFull is returned when the mempool is at its cap and the new
+// transaction does not pay more per byte than anything it could evict.
+var ErrMempoolFull = errors.New("mempool is full and the transaction pays too little to evict another")
+
+// ErrAlreadyKnown is returned when the very same transaction is already
+// waiting in the mempool.
+var ErrAlreadyKnown = errors.New("transaction is already in the mempool")
+
+// ReplacementUnderpricedError is returned when a transaction reuses the nonce
+// of a pending one without raising the fee by the minimum bump.
+type ReplacementUnderpricedError struct {
+	Address string
+	Nonce   uint64
+	Fee     uint64
+	MinFee  uint64
+}
+
+func (e *ReplacementUnderpricedError) Error() string {
+	return fmt.Sprintf("replacement underpriced: %s nonce %d pays fee %d, replacing the pending transaction needs at least %d", e.Address, e.Nonce, e.Fee, e.MinFee)
+}
+
+// SenderLimitError is returned when a sender already has as many
+// transactions waiting as the mempool allows.
+type SenderLimitError struct {
+	Address string
+	Limit   int
+}
+
+func (e *SenderLimitError) Error() string {
+	return fmt.Sprintf("%s already has %d transactions waiting in the mempool", e.Address, e.Limit)
+}
+
+// MempoolConfig bounds the mempool. Expiry is how long a transaction may
+// wait before it is dropped. MinBumpPercent is how much higher, in percent,
+// the fee of a replacement has to be than that of the transaction it
+// replaces.
+type MempoolConfig struct {
+	MaxTxns        int
+	MaxPerSender   int
+	Expiry         time.Duration
+	MinBumpPercent uint64
+}
+
+func DefaultMempoolConfig() MempoolConfig {
+	return MempoolConfig{
+		MaxTxns:        constants.MEMPOOL_MAX_TXNS,
+		MaxPerSender:   constants.MEMPOOL_MAX_PER_SENDER,
+		Expiry:         constants.MEMPOOL_EXPIRY * time.Second,
+		MinBumpPercent: constants.MEMPOOL_MIN_BUMP_PERCENT,
+	}
+}
+
+// MempoolStats is a snapshot of the mempool for GET /mempool/stats.
+// Evicted, Expired, Replaced and Rejected count since the node started.
+type MempoolStats struct {
+	Count         int     `json:"count"`
+	Bytes         int     `json:"bytes"`
+	Senders       int     `json:"senders"`
+	MaxTxns       int     `json:"max_txns"`
+	MaxPerSender  int     `json:"max_per_sender"`
+	ExpirySeconds int64   `json:"expiry_seconds"`
+	MinFeeRate    float64 `json:"min_fee_rate"`
+	Evicted       uint64  `json:"evicted"`
+	Expired       uint64  `json:"expired"`
+	Replaced      uint64  `json:"replaced"`
+	Rejected      uint64  `json:"rejected"`
+}
+
+// mempoolEntry is a waiting transaction with its hash and size, worked out
+// once when it arrives rather than on every look at the pool.
+type mempoolEntry struct {
+	txn     *Transaction
+	hash    string
+	size    int
+	arrived time.Time
+}
+
+func newMempoolEntry(txn *Transaction, arrived time.Time) *mempoolEntry {
+	return &mempoolEntry{txn: txn, hash: txn.Hash(), size: txn.Size(), arrived: arrived}
+}
+
+// feeRate is the FeeRate of the transaction.
+func (e *mempoolEntry) feeRate() float64 {
+	return float64(e.txn.Fee) / float64(e.size)
+}
+
+// Mempool holds the transactions waiting to be mined, in arrival order. It
+// is safe for concurrent use and marshals to the plain list of its
+// transactions. With a journal store every change is also written there, so
+// the waiting transactions survive a restart.
+type Mempool struct {
+	mutex    sync.RWMutex
+	config   MempoolConfig
+	pool     []*mempoolEntry
+	byHash   map[string]*mempoolEntry
+	journal  ChainStore
+	evicted  uint64
+	expired  uint64
+	replaced uint64
+	rejected uint64
+}
+
+func NewMempool(config MempoolConfig) *Mempool {
+	return &Mempool{
+		config: config,
+		pool:   []*mempoolEntry{},
+		byHash: map[string]*mempoolEntry{},
+	}
+}
+
+// SetConfig changes the bounds of the mempool. Transactions already in it
+// stay until they are mined, evicted or expire.
+func (mp *Mempool) SetConfig(config MempoolConfig) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	mp.config = config
+}
+
+// Add puts txn in the mempool. When the sender already has a transaction
+// pending with the same nonce, txn replaces it if it raises the fee by the
+// minimum bump and fails with a ReplacementUnderpricedError otherwise.
+// Otherwise Add fails with a SenderLimitError when the sender is at its cap,
+// and with ErrMempoolFull when the mempool is full and txn pays no more per
+// byte than the cheapest transaction it could evict.
+func (mp *Mempool) Add(txn *Transaction) (err error) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	batch := NewStoreBatch()
+	defer func() {
+		if journalErr := mp.flush(batch); err == nil {
+			err = journalErr
+		}
+	}()
+
+	mp.expire(time.Now(), batch)
+
+	entry := newMempoolEntry(txn, time.Now())
+	if _, ok := mp.byHash[entry.hash]; ok {
+		return ErrAlreadyKnown
+	}
+
+	if i := mp.pending(txn.From, txn.Nonce); i >= 0 {
+		old := mp.pool[i]
+		if minFee := mp.minReplacementFee(old.txn); txn.Fee < minFee {
+			mp.rejected++
+			return &ReplacementUnderpricedError{Address: txn.From, Nonce: txn.Nonce, Fee: txn.Fee, MinFee: minFee}
+		}
+		delete(mp.byHash, old.hash)
+		batch.Delete(journalKey(old.hash))
+		mp.pool[i] = entry
+		mp.byHash[entry.hash] = entry
+		mp.journalPut(batch, txn, entry.arrived)
+		mp.replaced++
+		return nil
+	}
+
+	if mp.senderCount(txn.From) >= mp.config.MaxPerSender {
+		mp.rejected++
+		return &SenderLimitError{Address: txn.From, Limit: mp.config.MaxPerSender}
+	}
+
+	if len(mp.pool) >= mp.config.MaxTxns {
+		victim := mp.evictionCandidate(txn.From)
+		if victim < 0 || !outbids(entry, mp.pool[victim]) {
+			mp.rejected++
+			return ErrMempoolFull
+		}
+		mp.removeAt(victim, batch)
+		mp.evicted++
+	}
+
+	mp.pool = append(mp.pool, entry)
+	mp.byHash[entry.hash] = entry
+	mp.journalPut(batch, txn, entry.arrived)
+	return nil
+}
+
+// pending returns the index of the transaction of address with the given
+// nonce that passed verification, or -1.
+func (mp *Mempool) pending(address string, nonce uint64) int {
+	for i, entry := range mp.pool {
+		txn := entry.txn
+		if txn.From == address && txn.Nonce == nonce && txn.Status != constants.TXN_VERIFICATION_FAILURE {
+			return i
+		}
+	}
+	return -1
+}
+
+// minReplacementFee is the lowest fee a transaction replacing old may pay.
+// It is always above the fee of old, even when that fee is tiny.
+func (mp *Mempool) minReplacementFee(old *Transaction) uint64 {
+	bump := old.Fee * mp.config.MinBumpPercent / 100
+	if bump == 0 {
+		bump = 1
+	}
+	return old.Fee + bump
+}
+
+// Pending returns the transaction of address with the given nonce that is
+// waiting to be mined, or nil.
+func (mp *Mempool) Pending(address string, nonce uint64) *Transaction {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+
+	if i := mp.pending(address, nonce); i >= 0 {
+		return mp.pool[i].txn
+	}
+	return nil
+}
+
+// outbids reports whether entry may take the place of victim. Transactions
+// that failed verification give way to anything.
+func outbids(entry, victim *mempoolEntry) bool {
+	if victim.txn.Status == constants.TXN_VERIFICATION_FAILURE {
+		return true
+	}
+	return entry.feeRate() > victim.feeRate()
+}
+
+func (mp *Mempool) senderCount(address string) int {
+	count := 0
+	for _, entry := range mp.pool {
+		if entry.txn.From == address {
+			count++
+		}
+	}
+	return count
+}
+
+// evictionCandidate picks the transaction to drop when the mempool is full:
+// a transaction that failed verification if there is one, otherwise the
+// cheapest per byte of the last pending transactions of each sender, so no
+// sender is left with a gap in its nonces. The sender of the incoming
+// transaction is left alone. It returns -1 when nothing can be evicted.
+func (mp *Mempool) evictionCandidate(exclude string) int {
+	tails := map[string]int{}
+	for i, entry := range mp.pool {
+		txn := entry.txn
+		if txn.From == exclude {
+			continue
+		}
+		if txn.Status == constants.TXN_VERIFICATION_FAILURE {
+			return i
+		}
+		if j, ok := tails[txn.From]; !ok || txn.Nonce > mp.pool[j].txn.Nonce {
+			tails[txn.From] = i
+		}
+	}
+
+	victim := -1
+	for _, i := range tails {
+		if victim < 0 {
+			victim = i
+			continue
+		}
+		rate, victimRate := mp.pool[i].feeRate(), mp.pool[victim].feeRate()
+		// on equal rates the later arrival goes first
+		if rate < victimRate || (rate == victimRate && i > victim) {
+			victim = i
+		}
+	}
+	return victim
+}
+
+func (mp *Mempool) removeAt(i int, batch *StoreBatch) {
+	hash := mp.pool[i].hash
+	delete(mp.byHash, hash)
+	batch.Delete(journalKey(hash))
+	mp.pool = append(mp.pool[:i:i], mp.pool[i+1:]...)
+}
+
+// Expire drops the transactions that have waited longer than the expiry,
+// together with the later nonces of their senders, which could no longer be
+// mined. It returns how many transactions were dropped.
+func (mp *Mempool) Expire(now time.Time) int {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	batch := NewStoreBatch()
+	dropped := mp.expire(now, batch)
+	if err := mp.flush(batch); err != nil {
+		log.Println("Error writing the mempool journal:", err)
+	}
+	return dropped
+}
+
+func (mp *Mempool) expire(now time.Time, batch *StoreBatch) int {
+	cutoff := map[string]uint64{}
+	for _, entry := range mp.pool {
+		if now.Sub(entry.arrived) <= mp.config.Expiry {
+			continue
+		}
+		if nonce, ok := cutoff[entry.txn.From]; !ok || entry.txn.Nonce < nonce {
+			cutoff[entry.txn.From] = entry.txn.Nonce
+		}
+	}
+	if len(cutoff) == 0 {
+		return 0
+	}
+
+	kept := []*mempoolEntry{}
+	dropped := 0
+	for _, entry := range mp.pool {
+		if nonce, ok := cutoff[entry.txn.From]; ok && entry.txn.Nonce >= nonce {
+			delete(mp.byHash, entry.hash)
+			batch.Delete(journalKey(entry.hash))
+			dropped++
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	mp.pool = kept
+	mp.expired += uint64(dropped)
+	return dropped
+}
+
+// RemoveBlock drops the transactions mined in b.
+func (mp *Mempool) RemoveBlock(b *Block) error {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	mined := map[string]bool{}
+	for _, txn := range b.Transactions {
+		mined[txn.Hash()] = true
+	}
+
+	batch := NewStoreBatch()
+	kept := []*mempoolEntry{}
+	for _, entry := range mp.pool {
+		if mined[entry.hash] {
+			delete(mp.byHash, entry.hash)
+			batch.Delete(journalKey(entry.hash))
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	mp.pool = kept
+	return mp.flush(batch)
+}
+
+// Get returns the transaction with the given hash, or nil.
+func (mp *Mempool) Get(hash string) *Transaction {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+
+	if entry, ok := mp.byHash[hash]; ok {
+		return entry.txn
+	}
+	return nil
+}
+
+// Transactions returns the waiting transactions in arrival order.
+func (mp *Mempool) Transactions() []*Transaction {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+
+	txns := make([]*Transaction, len(mp.pool))
+	for i, entry := range mp.pool {
+		txns[i] = entry.txn
+	}
+	return txns
+}
+
+// entries returns the waiting transactions with the time they arrived.
+func (mp *Mempool) entries() []journalEntry {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+
+	entries := []journalEntry{}
+	for _, entry := range mp.pool {
+		entries = append(entries, journalEntry{Transaction: entry.txn, Arrived: entry.arrived.UnixNano()})
+	}
+	return entries
+}
+
+func (mp *Mempool) Len() int {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+
+	return len(mp.pool)
+}
+
+func (mp *Mempool) Stats() *MempoolStats {
+	mp.mutex.RLock()
+	defer mp.mutex.RUnlock()
+
+	stats := &MempoolStats{
+		Count:         len(mp.pool),
+		MaxTxns:       mp.config.MaxTxns,
+		MaxPerSender:  mp.config.MaxPerSender,
+		ExpirySeconds: int64(mp.config.Expiry / time.Second),
+		Evicted:       mp.evicted,
+		Expired:       mp.expired,
+		Replaced:      mp.replaced,
+		Rejected:      mp.rejected,
+	}
+	senders := map[string]bool{}
+	for i, entry := range mp.pool {
+		senders[entry.txn.From] = true
+		stats.Bytes += entry.size
+		if rate := entry.feeRate(); i == 0 || rate < stats.MinFeeRate {
+			stats.MinFeeRate = rate
+		}
+	}
+	stats.Senders = len(senders)
+	return stats
+}
+
+func (mp *Mempool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(mp.Transactions())
+}
+
+// UnmarshalJSON reads the plain list of transactions written by
+// MarshalJSON into a mempool with the default bounds.
+func (mp *Mempool) UnmarshalJSON(data []byte) error {
+	txns := []*Transaction{}
+	if err := json.Unmarshal(data, &txns); err != nil {
+		return err
+	}
+
+	mp.config = DefaultMempoolConfig()
+	now := time.Now().UnixNano()
+	entries := []journalEntry{}
+	for _, txn := range txns {
+		entries = append(entries, journalEntry{Transaction: txn, Arrived: now})
+	}
+	mp.restore(entries)
+	return nil
+}
+
+// restore replaces the content of the mempool with entries, as read back
+// from the store, without applying the caps or writing the journal.
+func (mp *Mempool) restore(entries []journalEntry) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	mp.pool = []*mempoolEntry{}
+	mp.byHash = map[string]*mempoolEntry{}
+	for _, entry := range entries {
+		e := newMempoolEntry(entry.Transaction, time.Unix(0, entry.Arrived))
+		mp.pool = append(mp.pool, e)
+		mp.byHash[e.hash] = e
+	}
+}
@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+// journalEntry is a waiting transaction as the mempool journal keeps it,
+// under MEMPOOL_JOURNAL_PREFIX + its hash. Arrived is in unix nanoseconds.
+type journalEntry struct {
+	Transaction *Transaction `json:"transaction"`
+	Arrived     int64        `json:"arrived"`
+}
+
+func journalKey(hash string) []byte {
+	return []byte(constants.MEMPOOL_JOURNAL_PREFIX + hash)
+}
+
+func (mp *Mempool) journalPut(batch *StoreBatch, txn *Transaction, arrived time.Time) {
+	value, err := json.Marshal(journalEntry{Transaction: txn, Arrived: arrived.UnixNano()})
+	if err != nil {
+		log.Println("Error encoding a mempool journal entry:", err)
+		return
+	}
+	batch.Put(journalKey(txn.Hash()), value)
+}
+
+// flush writes the journal changes of one mempool operation. It does
+// nothing for a mempool without a journal.
+func (mp *Mempool) flush(batch *StoreBatch) error {
+	if mp.journal == nil || batch.Len() == 0 {
+		return nil
+	}
+	return mp.journal.Write(batch)
+}
+
+// readMempoolJournal returns the journaled transactions in arrival order.
+// A pool saved as a single list by older versions is read as well, as if
+// its transactions had just arrived.
+func readMempoolJournal(store ChainStore) ([]journalEntry, error) {
+	entries := []journalEntry{}
+	var decodeErr error
+	err := store.Iterate([]byte(constants.MEMPOOL_JOURNAL_PREFIX), nil, false, func(key, value []byte) bool {
+		var entry journalEntry
+		if decodeErr = json.Unmarshal(value, &entry); decodeErr != nil {
+			return false
+		}
+		entries = append(entries, entry)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	legacy, err := GetTransactionPool(store)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixNano()
+	for _, txn := range legacy {
+		entries = append(entries, journalEntry{Transaction: txn, Arrived: now})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Arrived < entries[j].Arrived
+	})
+	return entries, nil
+}
+
+// restoreMempool fills the mempool from its journal, dropping what no
+// longer fits the chain as it is now.
+func (bc *BlockchainStruct) restoreMempool() error {
+	entries, err := readMempoolJournal(bc.Store)
+	if err != nil {
+		return err
+	}
+
+	kept, err := bc.refillMempool(entries)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		log.Printf("Restored %d of %d journaled transactions to the mempool", len(kept), len(entries))
+	}
+	return nil
+}
+
+// refillMempool replaces the content of the mempool with entries. Every
+// transaction is checked again against the accounts of our chain: the ones
+// that are already mined, that expired, that failed verification, or that
+// their sender can no longer cover or whose nonce no longer follows, are
+// dropped, from the journal as well. It returns the entries that were kept.
+func (bc *BlockchainStruct) refillMempool(entries []journalEntry) ([]journalEntry, error) {
+	// check each sender's transactions in nonce order
+	byNonce := append([]journalEntry{}, entries...)
+	sort.SliceStable(byNonce, func(i, j int) bool {
+		if byNonce[i].Transaction.From != byNonce[j].Transaction.From {
+			return byNonce[i].Transaction.From < byNonce[j].Transaction.From
+		}
+		return byNonce[i].Transaction.Nonce < byNonce[j].Transaction.Nonce
+	})
+
+	batch := NewStoreBatch()
+	batch.Delete([]byte(constants.TXN_POOL_KEY))
+	cutoff := time.Now().Add(-bc.Mempool.config.Expiry).UnixNano()
+	state := newAccountState(bc.Store)
+	valid := map[string]bool{}
+	for _, entry := range byNonce {
+		txn := entry.Transaction
+		hash := txn.Hash()
+
+		drop := valid[hash] || txn.Status != constants.TXN_VERIFICATION_SUCCESS || entry.Arrived < cutoff
+		if !drop {
+			_, err := GetTxnLocation(bc.Store, hash)
+			if err == nil {
+				drop = true
+			} else if err != ErrNotFound {
+				return nil, err
+			}
+		}
+		if !drop && !txn.VerifyTxn() {
+			log.Println("Dropping txn from the mempool: signature of", hash, "does not verify")
+			drop = true
+		}
+		if !drop {
+			if err := state.checkTxn(txn); err != nil {
+				log.Println("Dropping txn from the mempool:", err)
+				drop = true
+			}
+		}
+		if drop {
+			if !valid[hash] {
+				batch.Delete(journalKey(hash))
+			}
+			continue
+		}
+
+		mined := *txn
+		mined.Status = constants.SUCCESS
+		if err := state.applyTxn(&mined); err != nil {
+			return nil, err
+		}
+		valid[hash] = true
+	}
+
+	kept := []journalEntry{}
+	for _, entry := range entries {
+		hash := entry.Transaction.Hash()
+		if valid[hash] {
+			kept = append(kept, entry)
+			bc.Mempool.journalPut(batch, entry.Transaction, time.Unix(0, entry.Arrived))
+			delete(valid, hash)
+		}
+	}
+	if err := bc.Store.Write(batch); err != nil {
+		return nil, err
+	}
+
+	bc.Mempool.restore(kept)
+	return kept, nil
+}
@@ -0,0 +1,58 @@
+package blockchain
+
+import (
+	"testing"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+func TestMempoolJournalRestore(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			bc := NewBlockchain(store, *NewBlock("0x0", 0, 0), "", nil, nil)
+
+			alice := newTestKey(t)
+			reward := NewTransaction(constants.BLOCKCHAIN_ADDRESS, alice.address, 100, []byte{})
+			reward.Status = constants.SUCCESS
+			b1 := NewBlock(bc.Blocks[0].Hash(), 0, 1)
+			b1.Transactions = append(b1.Transactions, reward)
+			bc.AddBlock(b1)
+
+			first := alice.sign(t, "bob", 10, 1, 0)
+			second := alice.sign(t, "bob", 10, 1, 1)
+			forged := alice.sign(t, "bob", 10, 1, 2)
+			forged.Value++
+			broke := pendingTxn("carol", 0, 1)
+			for _, txn := range []*Transaction{first, second, forged, broke} {
+				txn.Status = constants.TXN_VERIFICATION_SUCCESS
+				if err := bc.Mempool.Add(txn); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// the first txn gets mined, but the node goes down before it
+			// takes it out of the pool
+			mined := *first
+			mined.Status = constants.SUCCESS
+			b2 := NewBlock(b1.Hash(), 0, 2)
+			b2.Transactions = append(b2.Transactions, &mined)
+			if err := PutBlock(store, b2); err != nil {
+				t.Fatal(err)
+			}
+
+			restarted := NewBlockchain(store, *NewBlock("0x0", 0, 0), "", nil, nil)
+			txns := restarted.Mempool.Transactions()
+			if len(txns) != 1 || txns[0].Hash() != second.Hash() {
+				t.Fatalf("Expected only alice's second txn to be restored, got %d txns", len(txns))
+			}
+
+			entries, err := readMempoolJournal(store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("Expected the dropped txns to leave the journal, %d entries remain", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+func pendingTxn(from string, nonce, fee uint64) *Transaction {
+	txn := NewTransaction(from, "bob", 10, []byte{})
+	txn.Nonce = nonce
+	txn.Fee = fee
+	txn.Status = constants.TXN_VERIFICATION_SUCCESS
+	return txn
+}
+
+func TestMempoolEvictsCheapestTail(t *testing.T) {
+	mp := NewMempool(MempoolConfig{MaxTxns: 3, MaxPerSender: 3, Expiry: time.Hour})
+	aliceHead := pendingTxn("alice", 0, 1)
+	aliceTail := pendingTxn("alice", 1, 900)
+	carol := pendingTxn("carol", 0, 50)
+	for _, txn := range []*Transaction{aliceHead, aliceTail, carol} {
+		if err := mp.Add(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mp.Add(pendingTxn("dave", 0, 10)); !errors.Is(err, ErrMempoolFull) {
+		t.Fatalf("Expected a cheap txn to be turned away, got %v", err)
+	}
+
+	// alice's cheap head is protected by her expensive tail, so carol goes
+	if err := mp.Add(pendingTxn("dave", 0, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if mp.Get(carol.Hash()) != nil || mp.Get(aliceHead.Hash()) == nil {
+		t.Error("Expected carol's txn to be evicted and alice's kept")
+	}
+	if stats := mp.Stats(); stats.Evicted != 1 || stats.Rejected != 1 || stats.Count != 3 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestMempoolSenderLimit(t *testing.T) {
+	mp := NewMempool(MempoolConfig{MaxTxns: 10, MaxPerSender: 2, Expiry: time.Hour})
+	mp.Add(pendingTxn("alice", 0, 1))
+	mp.Add(pendingTxn("alice", 1, 1))
+
+	var limitErr *SenderLimitError
+	if err := mp.Add(pendingTxn("alice", 2, 1)); !errors.As(err, &limitErr) {
+		t.Fatalf("Expected a SenderLimitError, got %v", err)
+	}
+}
+
+func TestMempoolExpiryDropsLaterNonces(t *testing.T) {
+	mp := NewMempool(MempoolConfig{MaxTxns: 10, MaxPerSender: 10, Expiry: time.Minute})
+	mp.Add(pendingTxn("alice", 0, 1))
+	mp.Add(pendingTxn("alice", 1, 1))
+	mp.Add(pendingTxn("carol", 0, 1))
+
+	// alice's first txn has been waiting too long
+	mp.pool[0].arrived = time.Now().Add(-time.Hour)
+
+	if dropped := mp.Expire(time.Now()); dropped != 2 {
+		t.Fatalf("Expected both of alice's txns to go, dropped %d", dropped)
+	}
+	if txns := mp.Transactions(); len(txns) != 1 || txns[0].From != "carol" {
+		t.Errorf("Expected only carol's txn to remain, got %d", len(txns))
+	}
+}
+
+func TestMempoolReplaceByFee(t *testing.T) {
+	mp := NewMempool(MempoolConfig{MaxTxns: 10, MaxPerSender: 10, Expiry: time.Hour, MinBumpPercent: 10})
+	original := pendingTxn("alice", 0, 100)
+	mp.Add(original)
+
+	if err := mp.Add(original); !errors.Is(err, ErrAlreadyKnown) {
+		t.Errorf("Expected a resubmission to be reported as known, got %v", err)
+	}
+
+	var underpriced *ReplacementUnderpricedError
+	if err := mp.Add(pendingTxn("alice", 0, 109)); !errors.As(err, &underpriced) || underpriced.MinFee != 110 {
+		t.Fatalf("Expected an underpriced replacement needing 110, got %v", err)
+	}
+
+	bumped := pendingTxn("alice", 0, 110)
+	if err := mp.Add(bumped); err != nil {
+		t.Fatal(err)
+	}
+	if txns := mp.Transactions(); len(txns) != 1 || txns[0] != bumped {
+		t.Errorf("Expected the bumped txn to replace the original, got %d txns", len(txns))
+	}
+	if stats := mp.Stats(); stats.Replaced != 1 {
+		t.Errorf("Expected 1 replacement but got %d", stats.Replaced)
+	}
+}
@@ -0,0 +1,123 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+// unminableBits is a target of 1, which no hash will meet in a test run.
+const unminableBits = 0x03000001
+
+func TestMineWorkers(t *testing.T) {
+	b := NewBlock("0x0", 0, 1)
+	b.Bits = 0x1f0fffff
+	if err := b.Mine(context.Background(), 4); err != nil {
+		t.Fatal(err)
+	}
+	if !meetsProofOfWork(b.Hash(), b.Target()) {
+		t.Errorf("Expected the mined block's hash %s to meet its target", b.Hash())
+	}
+}
+
+func TestMineCancelled(t *testing.T) {
+	b := NewBlock("0x0", 0, 1)
+	b.Bits = unminableBits
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := b.Mine(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected mining to stop with the context, got %v", err)
+	}
+	if b.Nonce != 0 {
+		t.Errorf("Expected an abandoned block to keep its nonce, got %d", b.Nonce)
+	}
+}
+
+func TestMineNewBlockAbortsOnNewTip(t *testing.T) {
+	genesis := NewBlock("0x0", 0, 0)
+	genesis.Bits = unminableBits
+	bc := NewBlockchain(NewMemoryStore(), *genesis, "", nil, nil)
+	bc.MiningWorkers = 2
+
+	// the template is taken before the tip moves, as MineNewBlock takes it
+	b, tipChanged, err := bc.newBlockTemplate("miner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- bc.mineTemplate(context.Background(), b, tipChanged)
+	}()
+	bc.AddBlock(NewBlock(bc.Blocks[0].Hash(), 0, 1))
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected mining to be abandoned, got %v", err)
+		}
+	case <-time.After(constants.MINING_PAUSE_TIME * time.Second):
+		t.Fatal("Expected mining to stop once the tip changed")
+	}
+}
+
+func TestMineNewBlockPaysMiner(t *testing.T) {
+	bc := NewBlockchain(NewMemoryStore(), *testGenesis(), "", nil, nil)
+	bc.MiningWorkers = 1
+
+	b, err := bc.MineNewBlock(context.Background(), "miner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ValidateBlock(b); err != nil {
+		t.Fatalf("Expected the mined block to validate, got %v", err)
+	}
+	bc.AddBlock(b)
+	if miner, _ := bc.GetAccount("miner"); miner.Balance != constants.MINING_REWARD {
+		t.Errorf("Expected the miner to be paid %d, got %d", constants.MINING_REWARD, miner.Balance)
+	}
+}
+
+func TestMineNewBlockLeavesChainOpen(t *testing.T) {
+	genesis := NewBlock("0x0", 0, 0)
+	genesis.Bits = unminableBits
+	bc := NewBlockchain(NewMemoryStore(), *genesis, "", nil, nil)
+	bc.MiningWorkers = 1
+	alice := newTestKey(t)
+	fund(bc, alice.address, 100)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := bc.MineNewBlock(context.Background(), "miner")
+		done <- err
+	}()
+	// the template is built once MineNewBlock waits on the tip
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		bc.Mutex.Lock()
+		waiting := bc.tipChanged != nil
+		bc.Mutex.Unlock()
+		if waiting && !bc.IsMiningLocked() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected mining to be unlocked while the nonce is searched for")
+		}
+	}
+
+	if err := bc.AddTransaction(*alice.sign(t, "bob", 10, 1, 0)); err != nil {
+		t.Errorf("Expected a transaction to be taken while mining, got %v", err)
+	}
+	// a block consensus adopts meanwhile ends the search
+	bc.AddBlock(NewBlock(bc.Blocks[1].Hash(), 0, 2))
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected mining to be abandoned, got %v", err)
+		}
+	case <-time.After(constants.MINING_PAUSE_TIME * time.Second):
+		t.Fatal("Expected mining to stop once the tip changed")
+	}
+}
@@ -0,0 +1,48 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"KNIRVCHAIN-MAIN/peerManager"
+)
+
+// BlockFromRemote decodes a block a peer sent. The result has to hash to
+// what the peer's block hashes to, so a block that lost or changed anything
+// on the way is refused rather than adopted in a different form, and so is
+// one whose transactions are not the ones its header commits to.
+func BlockFromRemote(rb *peerManager.RemoteBlock) (*Block, error) {
+	b := &Block{BlockHeader: headerFromRemote(rb.RemoteBlockHeader)}
+	if len(rb.Transactions) > 0 {
+		// the header commits to what the transactions hash to, which a
+		// field we do not know takes no part in, so such a field is
+		// refused here rather than dropped
+		decoder := json.NewDecoder(bytes.NewReader(rb.Transactions))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&b.Transactions); err != nil {
+			return nil, fmt.Errorf("block %d: %w", rb.BlockNumber, err)
+		}
+	}
+
+	if hash, remoteHash := b.Hash(), rb.RemoteHash(); hash != remoteHash {
+		return nil, fmt.Errorf("block %d: decoded hash %s does not match the peer's %s", rb.BlockNumber, hash, remoteHash)
+	}
+	if err := b.checkMerkleRoot(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// BlocksFromRemote decodes blocks with BlockFromRemote.
+func BlocksFromRemote(remoteBlocks []*peerManager.RemoteBlock) ([]*Block, error) {
+	blocks := make([]*Block, len(remoteBlocks))
+	for i, rb := range remoteBlocks {
+		b, err := BlockFromRemote(rb)
+		if err != nil {
+			return nil, err
+		}
+		blocks[i] = b
+	}
+	return blocks, nil
+}
@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"KNIRVCHAIN-MAIN/peerManager"
+)
+
+func TestBlockFromRemoteKeepsTransactions(t *testing.T) {
+	b := NewBlock("0xabc", 42, 7)
+	b.Transactions = append(b.Transactions, pendingTxn("alice", 3, 25))
+	b.SetMerkleRoot()
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rb peerManager.RemoteBlock
+	if err := json.Unmarshal(data, &rb); err != nil {
+		t.Fatal(err)
+	}
+	got, err := BlockFromRemote(&rb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Hash() != b.Hash() {
+		t.Errorf("Expected hash %s but got %s", b.Hash(), got.Hash())
+	}
+	if synced, _ := json.Marshal(got); !bytes.Equal(synced, data) {
+		t.Errorf("Expected the synced block to be byte-identical\n got %s\nwant %s", synced, data)
+	}
+
+	// a field our transactions do not know would be lost on the way
+	rb.Transactions = bytes.Replace(rb.Transactions, []byte(`"fee":25`), []byte(`"fee":25,"tip":1`), 1)
+	if _, err := BlockFromRemote(&rb); err == nil {
+		t.Error("Expected a block that does not decode losslessly to be refused")
+	}
+}
+
+func TestBlockFromRemoteChecksMerkleRoot(t *testing.T) {
+	b := NewBlock("0xabc", 42, 7)
+	b.Transactions = append(b.Transactions, pendingTxn("alice", 3, 25))
+	b.SetMerkleRoot()
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rb peerManager.RemoteBlock
+	if err := json.Unmarshal(data, &rb); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BlockFromRemote(&rb); err != nil {
+		t.Fatal(err)
+	}
+
+	// the header still hashes the same, but no longer commits to the body
+	rb.Transactions = bytes.Replace(rb.Transactions, []byte(`"fee":25`), []byte(`"fee":26`), 1)
+	if _, err := BlockFromRemote(&rb); err == nil || !strings.Contains(err.Error(), "merkle root") {
+		t.Errorf("Expected a body that does not match its merkle root to be refused, got %v", err)
+	}
+}
+
+func TestBlockFromRemoteNeedsMerkleRoot(t *testing.T) {
+	b := NewBlock("0xabc", 42, 7)
+	b.Transactions = append(b.Transactions, pendingTxn("alice", 3, 25))
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rb peerManager.RemoteBlock
+	if err := json.Unmarshal(data, &rb); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BlockFromRemote(&rb); err == nil || !strings.Contains(err.Error(), "merkle root") {
+		t.Errorf("Expected a block above genesis without a merkle root to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"KNIRVCHAIN-MAIN/constants"
+	"KNIRVCHAIN-MAIN/events"
+)
+
+// ErrUnconnectedChain is returned for a chain segment that does not build
+// on any block of our chain.
+var ErrUnconnectedChain = errors.New("chain does not connect to ours")
+
+// ErrForeignGenesis is returned for a chain that starts from a genesis
+// block other than ours. Nothing checks the proof of work of a genesis
+// block, so such a chain could claim whatever work it likes.
+var ErrForeignGenesis = errors.New("chain starts from another genesis block")
+
+// ErrNotHeavier is returned by SwitchToHeavier for a branch that does not
+// carry more work than our chain.
+var ErrNotHeavier = errors.New("chain does not carry more work than ours")
+
+// forkPoint returns how many leading blocks of the segment blocks we already
+// have. The block after them has to build on one of our blocks; only a
+// node without any chain yet takes a genesis block from a segment.
+func (bc *BlockchainStruct) forkPoint(blocks []*Block) (int, error) {
+	shared := 0
+	for shared < len(blocks) {
+		number := blocks[shared].BlockNumber
+		if number >= uint64(len(bc.Blocks)) || bc.Blocks[number].Hash() != blocks[shared].Hash() {
+			break
+		}
+		shared++
+	}
+	if shared == len(blocks) {
+		return shared, nil
+	}
+
+	next := blocks[shared]
+	if next.BlockNumber > uint64(len(bc.Blocks)) {
+		return 0, ErrUnconnectedChain
+	}
+	if next.BlockNumber == 0 && len(bc.Blocks) > 0 {
+		return 0, ErrForeignGenesis
+	}
+	if next.BlockNumber > 0 && bc.Blocks[next.BlockNumber-1].Hash() != next.PrevHash {
+		return 0, ErrUnconnectedChain
+	}
+	return shared, nil
+}
+
+// orphanedTxns returns the transactions of orphaned that connected does not
+// carry, ready to wait in the mempool again. Rewards and transactions that
+// failed are left out.
+func orphanedTxns(orphaned, connected []*Block) []*Transaction {
+	mined := map[string]bool{}
+	for _, b := range connected {
+		for _, txn := range b.Transactions {
+			mined[txn.Hash()] = true
+		}
+	}
+
+	txns := []*Transaction{}
+	for _, b := range orphaned {
+		for _, txn := range b.Transactions {
+			if txn.From == constants.BLOCKCHAIN_ADDRESS || txn.Status != constants.SUCCESS || mined[txn.Hash()] {
+				continue
+			}
+			requeued := *txn
+			requeued.Status = constants.TXN_VERIFICATION_SUCCESS
+			txns = append(txns, &requeued)
+		}
+	}
+	return txns
+}
+
+// SwitchChain moves our chain onto the branch that blocks belong to. The
+// blocks may be a whole chain or a segment that hangs off ours. Our blocks
+// from the common ancestor up are reverted, the transactions only they
+// carried go back to the mempool if they are still valid, and a
+// ChainReorgEvent is sent when any of our blocks were replaced. Whether the
+// branch is better than ours is for the caller to decide.
+func (bc *BlockchainStruct) SwitchChain(blocks []*Block) error {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+
+	return bc.switchChain(blocks)
+}
+
+// SwitchToHeavier switches our chain to the branch blocks belong to if it
+// carries more work than ours and is valid, and returns ErrNotHeavier when
+// it does not outweigh us. Comparing, validating and switching happen under
+// one lock, so a block added meanwhile cannot leave us on a branch that is
+// lighter than our chain or was checked against another one.
+func (bc *BlockchainStruct) SwitchToHeavier(blocks []*Block) error {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+
+	work, err := bc.branchWork(blocks)
+	if err != nil {
+		return err
+	}
+	ours, err := bc.chainWork()
+	if err != nil {
+		return err
+	}
+	if work.Cmp(ours) <= 0 {
+		return ErrNotHeavier
+	}
+
+	if err := bc.validateChainSegment(blocks); err != nil {
+		return err
+	}
+	return bc.switchChain(blocks)
+}
+
+func (bc *BlockchainStruct) switchChain(blocks []*Block) error {
+	shared, err := bc.forkPoint(blocks)
+	if err != nil {
+		return err
+	}
+	if shared == len(blocks) {
+		return nil
+	}
+	for i := shared + 1; i < len(blocks); i++ {
+		if blocks[i].BlockNumber != blocks[i-1].BlockNumber+1 {
+			return fmt.Errorf("block %d follows block %d", blocks[i].BlockNumber, blocks[i-1].BlockNumber)
+		}
+	}
+
+	fork := blocks[shared].BlockNumber
+	connected := blocks[shared:]
+	orphaned := bc.Blocks[fork:]
+	chain := append(append([]*Block{}, bc.Blocks[:fork]...), connected...)
+	if err := putChainFrom(bc.Store, chain, fork); err != nil {
+		return err
+	}
+	oldHead := bc.Blocks[len(bc.Blocks)-1].Hash()
+	bc.Blocks = chain
+	bc.notifyTipChanged()
+
+	// the mempool is checked against the new chain, which drops what the
+	// new blocks mined and takes back what only the orphaned ones had
+	requeued := orphanedTxns(orphaned, connected)
+	now := time.Now().UnixNano()
+	entries := bc.Mempool.entries()
+	for _, txn := range requeued {
+		entries = append(entries, journalEntry{Transaction: txn, Arrived: now})
+	}
+	kept, err := bc.refillMempool(entries)
+	if err != nil {
+		return err
+	}
+
+	if len(orphaned) == 0 {
+		return nil
+	}
+
+	back := map[string]bool{}
+	for _, txn := range requeued {
+		back[txn.Hash()] = true
+	}
+	event := events.ChainReorgEvent{
+		OldHead:    oldHead,
+		NewHead:    chain[len(chain)-1].Hash(),
+		ForkNumber: fork,
+		Orphaned:   len(orphaned),
+		Connected:  len(connected),
+	}
+	for _, entry := range kept {
+		if back[entry.Transaction.Hash()] {
+			event.Requeued++
+		}
+	}
+	log.Printf("Chain reorg at block %d: %d blocks orphaned, %d connected, %d txns requeued", fork, event.Orphaned, event.Connected, event.Requeued)
+
+	// nobody listening must not hold up the chain
+	select {
+	case bc.ChainReorg <- event:
+	default:
+	}
+	return nil
+}
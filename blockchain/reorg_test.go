@@ -0,0 +1,105 @@
+package blockchain
+
+import (
+	"testing"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+func TestSwitchChainRequeuesOrphanedTxns(t *testing.T) {
+	store := NewMemoryStore()
+	bc := NewBlockchain(store, *NewBlock("0x0", 0, 0), "", nil, nil)
+
+	alice := newTestKey(t)
+	reward := NewTransaction(constants.BLOCKCHAIN_ADDRESS, alice.address, 100, []byte{})
+	reward.Status = constants.SUCCESS
+	// mallory is funded too, but signs nothing
+	malloryReward := NewTransaction(constants.BLOCKCHAIN_ADDRESS, "mallory", 100, []byte{})
+	malloryReward.Status = constants.SUCCESS
+	b1 := NewBlock(bc.Blocks[0].Hash(), 0, 1)
+	b1.Transactions = append(b1.Transactions, reward, malloryReward)
+	bc.AddBlock(b1)
+
+	spend := alice.sign(t, "bob", 40, 0, 0)
+	ours := NewBlock(b1.Hash(), 0, 2)
+	ours.Transactions = append(ours.Transactions, spend)
+	bc.AddBlock(ours)
+
+	// alice already queued her next txn on top of the one in our block
+	next := alice.sign(t, "bob", 10, 1, 1)
+	next.Status = constants.TXN_VERIFICATION_SUCCESS
+	if err := bc.Mempool.Add(next); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Mempool.Add(pendingTxn("mallory", 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	theirs2 := NewBlock(b1.Hash(), 7, 2)
+	theirs3 := NewBlock(theirs2.Hash(), 0, 3)
+	if err := bc.SwitchChain([]*Block{b1, theirs2, theirs3}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bc.Blocks) != 4 || bc.Blocks[3].Hash() != theirs3.Hash() {
+		t.Fatalf("Expected to be on their branch, got %d blocks", len(bc.Blocks))
+	}
+	txns := bc.Mempool.Transactions()
+	if len(txns) != 2 || bc.Mempool.Pending(alice.address, 0) == nil || bc.Mempool.Pending(alice.address, 1) == nil {
+		t.Fatalf("Expected alice's orphaned and queued txns, and not mallory's unsigned one, in the mempool, got %d txns", len(txns))
+	}
+	account, _ := bc.GetAccount(alice.address)
+	if account.Balance != 100 || account.Nonce != 0 {
+		t.Errorf("Expected alice back at 100/0 but got %+v", account)
+	}
+
+	select {
+	case event := <-bc.ChainReorg:
+		if event.ForkNumber != 2 || event.Orphaned != 1 || event.Connected != 2 || event.Requeued != 1 {
+			t.Errorf("Unexpected reorg event %+v", event)
+		}
+	default:
+		t.Error("Expected a reorg event")
+	}
+
+	stranger := NewBlock("0xdead", 0, 5)
+	if err := bc.SwitchChain([]*Block{stranger}); err != ErrUnconnectedChain {
+		t.Errorf("Expected an unconnected segment to be refused, got %v", err)
+	}
+}
+
+// readCountingStore counts the reads of each key.
+type readCountingStore struct {
+	ChainStore
+	reads map[string]int
+}
+
+func (s *readCountingStore) Get(key []byte) ([]byte, error) {
+	s.reads[string(key)]++
+	return s.ChainStore.Get(key)
+}
+
+func TestSwitchChainStartsAtFork(t *testing.T) {
+	bc := NewBlockchain(NewMemoryStore(), *NewBlock("0x0", 0, 0), "", nil, nil)
+	for i := 1; i <= 3; i++ {
+		bc.AddBlock(NewBlock(bc.Blocks[i-1].Hash(), 0, uint64(i)))
+	}
+	store := &readCountingStore{ChainStore: bc.Store, reads: map[string]int{}}
+	bc.Store = store
+
+	theirs3 := NewBlock(bc.Blocks[2].Hash(), 7, 3)
+	theirs4 := NewBlock(theirs3.Hash(), 0, 4)
+	if err := bc.SwitchChain([]*Block{bc.Blocks[2], theirs3, theirs4}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the work of block 2 is read to build on, nothing below it
+	for number := uint64(0); number < 2; number++ {
+		if n := store.reads[string(blockNumberKey(number))]; n > 0 {
+			t.Errorf("Expected block %d below the fork not to be read, read it %d times", number, n)
+		}
+	}
+	if stored, err := GetBlocks(store); err != nil || len(stored) != 5 || stored[4].Hash() != theirs4.Hash() {
+		t.Errorf("Expected their branch to be stored, got %d blocks (%v)", len(stored), err)
+	}
+}
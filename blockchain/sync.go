@@ -0,0 +1,271 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"KNIRVCHAIN-MAIN/constants"
+	"KNIRVCHAIN-MAIN/peerManager"
+)
+
+// The states a Syncer reports.
+const (
+	SyncIdle    = "idle"
+	SyncHeaders = "headers"
+	SyncBodies  = "bodies"
+	SyncDone    = "done"
+	SyncFailed  = "failed"
+)
+
+// SyncStatus is the progress of a sync. Target is the number of blocks the
+// headers announce, Height the number of blocks on our chain.
+type SyncStatus struct {
+	State      string   `json:"state"`
+	Peers      []string `json:"peers"`
+	Height     uint64   `json:"height"`
+	Target     uint64   `json:"target"`
+	Downloaded int      `json:"downloaded"`
+	StartedAt  int64    `json:"started_at"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// Syncer brings our chain up to date with peers, headers first: it fetches
+// and checks the headers of a peer's whole chain, then downloads the bodies
+// we do not have in parallel batches spread over all peers. Bodies are
+// adopted as soon as they carry more work than our chain, so an interrupted
+// sync resumes from the blocks it already stored.
+type Syncer struct {
+	Blockchain *BlockchainStruct
+	Peers      []string
+	mutex      sync.Mutex
+	status     SyncStatus
+}
+
+func NewSyncer(bc *BlockchainStruct, peers []string) *Syncer {
+	return &Syncer{
+		Blockchain: bc,
+		Peers:      peers,
+		status:     SyncStatus{State: SyncIdle, Peers: peers},
+	}
+}
+
+// Status returns the progress of the last or running sync.
+func (s *Syncer) Status() SyncStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status := s.status
+	status.Height = s.Blockchain.height()
+	return status
+}
+
+func (s *Syncer) update(fn func(status *SyncStatus)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fn(&s.status)
+}
+
+// Run syncs our chain with the peers once.
+func (s *Syncer) Run() error {
+	s.update(func(status *SyncStatus) {
+		*status = SyncStatus{State: SyncHeaders, Peers: s.Peers, StartedAt: time.Now().Unix()}
+	})
+
+	err := s.run()
+	s.update(func(status *SyncStatus) {
+		if err != nil {
+			status.State = SyncFailed
+			status.Error = err.Error()
+		} else {
+			status.State = SyncDone
+		}
+	})
+	return err
+}
+
+func (s *Syncer) run() error {
+	if len(s.Peers) == 0 {
+		return errors.New("no peers to sync from")
+	}
+
+	headers, err := s.fetchHeaders(s.Blockchain.Retarget)
+	if err != nil {
+		return err
+	}
+	next := s.Blockchain.matchingHeaders(headers)
+	log.Printf("Syncing blocks %d to %d of %d", next, len(headers), len(headers))
+	s.update(func(status *SyncStatus) {
+		status.State = SyncBodies
+		status.Target = uint64(len(headers))
+	})
+
+	// bodies wait here until they outweigh our chain; after that each
+	// batch simply extends it
+	var pending []*Block
+	for next < len(headers) {
+		end := next + constants.BLOCK_RANGE_LIMIT*constants.SYNC_PARALLEL_FETCHES
+		if end > len(headers) {
+			end = len(headers)
+		}
+		blocks, err := s.fetchBodies(headers, next, end)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, blocks...)
+		next = end
+		s.update(func(status *SyncStatus) {
+			status.Downloaded += len(blocks)
+		})
+
+		adopted, err := s.adopt(pending)
+		if err != nil {
+			return err
+		}
+		if adopted {
+			pending = nil
+		}
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("chain of %d blocks from peers has no more work than ours", len(headers))
+	}
+	return nil
+}
+
+// adopt switches our chain to pending once it carries more work.
+func (s *Syncer) adopt(pending []*Block) (bool, error) {
+	err := s.Blockchain.SwitchToHeavier(pending)
+	if errors.Is(err, ErrNotHeavier) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// fetchHeaders fetches and checks the headers of the whole chain of the
+// first peer that answers.
+func (s *Syncer) fetchHeaders(r Retarget) ([]*peerManager.RemoteHeader, error) {
+	var err error
+	for _, peer := range s.Peers {
+		var headers []*peerManager.RemoteHeader
+		headers, err = fetchChainHeaders(peer, r)
+		if err == nil {
+			return headers, nil
+		}
+		log.Println("Error fetching headers from peer:", peer, err)
+	}
+	return nil, err
+}
+
+// fetchChainHeaders fetches the headers of the whole chain of peer, in
+// batches of SYNC_HEADERS_LIMIT that are each checked as they arrive.
+func fetchChainHeaders(peer string, r Retarget) ([]*peerManager.RemoteHeader, error) {
+	c := headerChecker{r: r}
+	for {
+		batch, err := peerManager.FetchHeaders(peer, uint64(len(c.headers)), constants.SYNC_HEADERS_LIMIT)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) > constants.SYNC_HEADERS_LIMIT {
+			return nil, fmt.Errorf("asked for at most %d headers, got %d", constants.SYNC_HEADERS_LIMIT, len(batch))
+		}
+		if err := c.add(batch); err != nil {
+			return nil, err
+		}
+		if len(batch) < constants.SYNC_HEADERS_LIMIT {
+			return c.headers, nil
+		}
+	}
+}
+
+// fetchBodies downloads the blocks of headers[from:to] in batches of
+// BLOCK_RANGE_LIMIT, each from its own peer. A batch a peer fails to serve
+// is asked of the other peers in turn.
+func (s *Syncer) fetchBodies(headers []*peerManager.RemoteHeader, from, to int) ([]*Block, error) {
+	var batches [][]*Block
+	var errs []error
+	var wg sync.WaitGroup
+	for start, i := from, 0; start < to; start, i = start+constants.BLOCK_RANGE_LIMIT, i+1 {
+		end := start + constants.BLOCK_RANGE_LIMIT
+		if end > to {
+			end = to
+		}
+		batches = append(batches, nil)
+		errs = append(errs, nil)
+
+		wg.Add(1)
+		go func(i int, want []*peerManager.RemoteHeader) {
+			defer wg.Done()
+			for attempt := 0; attempt < len(s.Peers); attempt++ {
+				peer := s.Peers[(i+attempt)%len(s.Peers)]
+				batches[i], errs[i] = fetchBodyBatch(peer, want)
+				if errs[i] == nil {
+					return
+				}
+				log.Println("Error fetching blocks from peer:", peer, errs[i])
+			}
+		}(i, headers[start:end])
+	}
+	wg.Wait()
+
+	blocks := []*Block{}
+	for i, batch := range batches {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		blocks = append(blocks, batch...)
+	}
+	return blocks, nil
+}
+
+// fetchBodyBatch downloads the blocks of want from peer and checks each
+// hashes to what its header claimed. A peer that sends fewer blocks than
+// asked for, to keep its answer small, is asked again for the rest.
+func fetchBodyBatch(peer string, want []*peerManager.RemoteHeader) ([]*Block, error) {
+	blocks := []*Block{}
+	for len(blocks) < len(want) {
+		rest := want[len(blocks):]
+		remoteBlocks, err := peerManager.FetchBlocks(peer, rest[0].BlockNumber, rest[len(rest)-1].BlockNumber)
+		if err != nil {
+			return nil, err
+		}
+		if len(remoteBlocks) == 0 || len(remoteBlocks) > len(rest) {
+			return nil, fmt.Errorf("asked for %d blocks from %d, got %d", len(rest), rest[0].BlockNumber, len(remoteBlocks))
+		}
+
+		batch, err := BlocksFromRemote(remoteBlocks)
+		if err != nil {
+			return nil, err
+		}
+		for i, b := range batch {
+			if hash := b.Hash(); hash != rest[i].Hash {
+				return nil, fmt.Errorf("block %d: hash %s does not match its header %s", rest[i].BlockNumber, hash, rest[i].Hash)
+			}
+		}
+		blocks = append(blocks, batch...)
+	}
+	return blocks, nil
+}
+
+// matchingHeaders returns how many leading headers match the blocks we
+// already have.
+func (bc *BlockchainStruct) matchingHeaders(headers []*peerManager.RemoteHeader) int {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+
+	n := 0
+	for n < len(headers) && n < len(bc.Blocks) && bc.Blocks[n].Hash() == headers[n].Hash {
+		n++
+	}
+	return n
+}
+
+func (bc *BlockchainStruct) height() uint64 {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+	return uint64(len(bc.Blocks))
+}
@@ -0,0 +1,234 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"KNIRVCHAIN-MAIN/constants"
+	"KNIRVCHAIN-MAIN/peerManager"
+)
+
+// loadMinedChain reads testdata/mined_chain.json, a genesis block and three
+// mined blocks that each pay the reward.
+func loadMinedChain(t *testing.T) []*Block {
+	data, err := os.ReadFile("testdata/mined_chain.json")
+	if err != nil {
+		t.Fatalf("Failed to read mined chain: %v", err)
+	}
+	var blocks []*Block
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		t.Fatalf("Failed to parse mined chain: %v", err)
+	}
+	return blocks
+}
+
+// servePeer serves /headers and /blocks of bc like a node does. tamper, if
+// set, may change the blocks before they are sent.
+func servePeer(t *testing.T, bc *BlockchainStruct, tamper func([]*Block) []*Block) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/headers", func(w http.ResponseWriter, r *http.Request) {
+		from, _ := strconv.ParseUint(r.URL.Query().Get("from"), 10, 64)
+		count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		json.NewEncoder(w).Encode(bc.Headers(from, count))
+	})
+	mux.HandleFunc("/blocks", func(w http.ResponseWriter, r *http.Request) {
+		from, _ := strconv.ParseUint(r.URL.Query().Get("from"), 10, 64)
+		to, _ := strconv.ParseUint(r.URL.Query().Get("to"), 10, 64)
+		blocks := bc.BlockRange(from, int(to-from+1))
+		if tamper != nil {
+			blocks = tamper(blocks)
+		}
+		json.NewEncoder(w).Encode(blocks)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSyncerHeadersFirst(t *testing.T) {
+	chain := loadMinedChain(t)
+	source := NewBlockchain(NewMemoryStore(), *chain[0], "", nil, nil)
+	for _, b := range chain[1:] {
+		source.AddBlock(b)
+	}
+
+	// the first peer changes the reward of every body it serves
+	liar := servePeer(t, source, func(blocks []*Block) []*Block {
+		forged := make([]*Block, len(blocks))
+		for i, b := range blocks {
+			copied := *b
+			copied.Transactions = nil
+			for _, txn := range b.Transactions {
+				changed := *txn
+				changed.Value++
+				copied.Transactions = append(copied.Transactions, &changed)
+			}
+			forged[i] = &copied
+		}
+		return forged
+	})
+	honest := servePeer(t, source, nil)
+
+	t.Run("fresh", func(t *testing.T) {
+		bc := NewBlockchain(NewMemoryStore(), *GenesisBlock(), "", nil, nil)
+		syncer := NewSyncer(bc, []string{liar.URL, honest.URL})
+		if err := syncer.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(bc.Blocks) != len(chain) {
+			t.Fatalf("Expected %d blocks but got %d", len(chain), len(bc.Blocks))
+		}
+		for i, b := range bc.Blocks {
+			if b.Hash() != chain[i].Hash() {
+				t.Errorf("block %d: expected hash %s but got %s", i, chain[i].Hash(), b.Hash())
+			}
+		}
+		status := syncer.Status()
+		if status.State != SyncDone || status.Height != 4 || status.Target != 4 || status.Downloaded != 3 {
+			t.Errorf("Unexpected sync status %+v", status)
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		store := NewMemoryStore()
+		if err := PutChain(store, chain[:2]); err != nil {
+			t.Fatal(err)
+		}
+		bc := NewBlockchain(store, *GenesisBlock(), "", nil, nil)
+		syncer := NewSyncer(bc, []string{honest.URL})
+		if err := syncer.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		if status := syncer.Status(); status.Height != 4 || status.Downloaded != 2 {
+			t.Errorf("Expected to fetch only the 2 missing blocks, got %+v", status)
+		}
+	})
+
+	t.Run("short answers", func(t *testing.T) {
+		// a peer keeping its answers small sends one block at a time
+		stingy := servePeer(t, source, func(blocks []*Block) []*Block {
+			return blocks[:1]
+		})
+		bc := NewBlockchain(NewMemoryStore(), *GenesisBlock(), "", nil, nil)
+		syncer := NewSyncer(bc, []string{stingy.URL})
+		if err := syncer.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if len(bc.Blocks) != len(chain) || bc.Blocks[len(chain)-1].Hash() != chain[len(chain)-1].Hash() {
+			t.Errorf("Expected the whole chain one block at a time, got %d blocks", len(bc.Blocks))
+		}
+	})
+
+	t.Run("another genesis", func(t *testing.T) {
+		bc := NewBlockchain(NewMemoryStore(), *NewBlock("0x0", 0, 0), "", nil, nil)
+		syncer := NewSyncer(bc, []string{honest.URL})
+		if err := syncer.Run(); !errors.Is(err, ErrForeignGenesis) {
+			t.Fatalf("Expected a chain from another genesis block to be refused, got %v", err)
+		}
+	})
+
+	t.Run("only liars", func(t *testing.T) {
+		bc := NewBlockchain(NewMemoryStore(), *GenesisBlock(), "", nil, nil)
+		syncer := NewSyncer(bc, []string{liar.URL})
+		if err := syncer.Run(); err == nil {
+			t.Fatal("Expected bodies that do not match their headers to be refused")
+		}
+		if status := syncer.Status(); status.State != SyncFailed || status.Height != 1 {
+			t.Errorf("Unexpected sync status %+v", status)
+		}
+	})
+}
+
+// remoteHeaders turns blocks into headers as a peer sends them.
+func remoteHeaders(t *testing.T, blocks ...*Block) []*peerManager.RemoteHeader {
+	headers := make([]Header, len(blocks))
+	for i, b := range blocks {
+		headers[i] = b.Header()
+	}
+	data, _ := json.Marshal(headers)
+	var remote []*peerManager.RemoteHeader
+	if err := json.Unmarshal(data, &remote); err != nil {
+		t.Fatal(err)
+	}
+	return remote
+}
+
+func TestCheckHeadersNeedRootAndBits(t *testing.T) {
+	chain := loadMinedChain(t)
+	if err := checkHeaders(DefaultRetarget(), remoteHeaders(t, chain...)); err != nil {
+		t.Fatalf("Expected the mined chain's headers to pass, got %v", err)
+	}
+
+	// a header without a root can claim any hash, since the hash would be
+	// the one of a body it does not carry
+	fake := []*Block{GenesisBlock()}
+	for i := 1; i <= 50; i++ {
+		b := NewBlock(fake[i-1].Hash(), 0, uint64(i))
+		b.Bits = DefaultRetarget().NextBits(fake)
+		fake = append(fake, b)
+	}
+	headers := remoteHeaders(t, fake...)
+	for _, h := range headers[1:] {
+		h.Hash = "0x" + strings.Repeat("0", 64)
+	}
+	for i := 2; i < len(headers); i++ {
+		headers[i].PrevHash = headers[i-1].Hash
+	}
+	if err := checkHeaders(DefaultRetarget(), headers); err == nil || !strings.Contains(err.Error(), "merkle root") {
+		t.Errorf("Expected unmined headers without a merkle root to be refused, got %v", err)
+	}
+
+	// without bits a header would fall back to the target of blocks from
+	// before targets
+	bitless := *chain[1]
+	bitless.Bits = 0
+	if err := checkHeaders(DefaultRetarget(), remoteHeaders(t, chain[0], &bitless)); err == nil || !strings.Contains(err.Error(), "target bits") {
+		t.Errorf("Expected a header without target bits to be refused, got %v", err)
+	}
+
+	// the timestamp is checked before the work, so an unmined header is
+	// enough to show it
+	early := *chain[2]
+	early.Timestamp = chain[0].Timestamp
+	if err := checkHeaders(DefaultRetarget(), remoteHeaders(t, chain[0], chain[1], &early)); err == nil || !strings.Contains(err.Error(), "timestamp") {
+		t.Errorf("Expected a header stamped before the median time to be refused, got %v", err)
+	}
+
+	claimed := remoteHeaders(t, chain[0], chain[1])
+	claimed[1].Nonce++
+	if err := checkHeaders(DefaultRetarget(), claimed); err == nil || !strings.Contains(err.Error(), "hashes to") {
+		t.Errorf("Expected a header that is not its claimed hash to be refused, got %v", err)
+	}
+}
+
+func TestFetchChainHeadersStopsAtBadBatch(t *testing.T) {
+	chain := loadMinedChain(t)
+
+	// a full batch that repeats the chain, so it breaks at its fifth
+	// header, served for every batch asked for
+	batch := make([]Header, constants.SYNC_HEADERS_LIMIT)
+	for i := range batch {
+		batch[i] = chain[i%len(chain)].Header()
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(batch)
+	}))
+	t.Cleanup(server.Close)
+
+	if _, err := fetchChainHeaders(server.URL, DefaultRetarget()); err == nil {
+		t.Fatal("Expected a bad header to be refused")
+	}
+	if requests != 1 {
+		t.Errorf("Expected to stop after the first batch, asked for %d", requests)
+	}
+}
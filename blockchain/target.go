@@ -0,0 +1,62 @@
+package blockchain
+
+import (
+	"math/big"
+	"strings"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+// A mining target is a 256 bit number the hash of a block, read as a big
+// endian integer, may not exceed. Blocks carry it in the compact "bits"
+// form: the top byte is the length of the target in bytes, the low three
+// bytes its most significant bytes. 0x1e0fffff, for instance, is 0x0fffff
+// shifted left by 27 bytes. The 0x00800000 bit would be a sign, which a
+// target never has.
+
+// CompactToTarget expands bits into the target it stands for.
+func CompactToTarget(bits uint32) *big.Int {
+	size := uint(bits >> 24)
+	target := big.NewInt(int64(bits & 0x007fffff))
+	if size <= 3 {
+		return target.Rsh(target, 8*(3-size))
+	}
+	return target.Lsh(target, 8*(size-3))
+}
+
+// TargetToCompact packs target into bits, dropping all but its three most
+// significant bytes.
+func TargetToCompact(target *big.Int) uint32 {
+	size := uint(len(target.Bytes()))
+	var mantissa uint64
+	if size <= 3 {
+		mantissa = target.Uint64() << (8 * (3 - size))
+	} else {
+		mantissa = new(big.Int).Rsh(target, 8*(size-3)).Uint64()
+	}
+
+	// a set top bit would read as a sign, so move it into a fourth byte
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		size++
+	}
+	return uint32(size)<<24 | uint32(mantissa)
+}
+
+// powLimit is the easiest target a block may have.
+func powLimit() *big.Int {
+	return CompactToTarget(constants.POW_LIMIT_BITS)
+}
+
+// zerosTarget is the target a hash with difficulty leading zero hex digits
+// meets, the rule blocks were mined under before targets.
+func zerosTarget(difficulty int) *big.Int {
+	target := new(big.Int).Lsh(big.NewInt(1), uint(256-4*difficulty))
+	return target.Sub(target, big.NewInt(1))
+}
+
+// meetsProofOfWork reports whether hash does not exceed target.
+func meetsProofOfWork(hash string, target *big.Int) bool {
+	value, ok := new(big.Int).SetString(strings.TrimPrefix(hash, constants.HEX_PREFIX), 16)
+	return ok && value.Cmp(target) <= 0
+}
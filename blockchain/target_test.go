@@ -0,0 +1,52 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestCompactTarget(t *testing.T) {
+	tests := []struct {
+		bits   uint32
+		target string
+	}{
+		{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000"},
+		{0x1e0fffff, "fffff000000000000000000000000000000000000000000000000000000"},
+		{0x03123456, "123456"},
+		{0x02123400, "1234"},
+		{0x04008000, "800000"},
+	}
+	for _, tt := range tests {
+		target := CompactToTarget(tt.bits)
+		if target.Text(16) != tt.target {
+			t.Errorf("%08x: expected target %s but got %s", tt.bits, tt.target, target.Text(16))
+		}
+		if bits := TargetToCompact(target); bits != tt.bits {
+			t.Errorf("%s: expected bits %08x but got %08x", tt.target, tt.bits, bits)
+		}
+	}
+}
+
+func TestTargetWork(t *testing.T) {
+	// blocks from before targets needed five zero hex digits, worth 16^5
+	legacy := Block{}
+	if want := big.NewInt(1 << 20); legacy.Work().Cmp(want) != 0 {
+		t.Errorf("Expected legacy work %s but got %s", want, legacy.Work())
+	}
+
+	halved := Block{BlockHeader: BlockHeader{Bits: TargetToCompact(new(big.Int).Rsh(legacy.Target(), 1))}}
+	if ratio := new(big.Int).Div(halved.Work(), legacy.Work()); ratio.Int64() != 2 {
+		t.Errorf("Expected half the target to take twice the work, got %s times", ratio)
+	}
+
+	hash := "0x" + legacy.Target().Text(16)
+	for len(hash) < 66 {
+		hash = "0x0" + hash[2:]
+	}
+	if !meetsProofOfWork(hash, legacy.Target()) {
+		t.Error("Expected a hash equal to the target to meet it")
+	}
+	if meetsProofOfWork(hash, halved.Target()) {
+		t.Error("Expected a hash above the target to miss it")
+	}
+}
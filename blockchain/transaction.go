@@ -1,13 +1,17 @@
 package blockchain
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"math"
 	"math/big"
+	"strings"
 	"time"
 
 	"KNIRVCHAIN-MAIN/constants"
@@ -17,6 +21,8 @@ type Transaction struct {
 	From      string `json:"from"`
 	To        string `json:"to"`
 	Value     uint64 `json:"value"`
+	Fee       uint64 `json:"fee,omitempty"`
+	Nonce     uint64 `json:"nonce,omitempty"`
 	Data      []byte `json:"data"`
 	Status    string `json:"status"`
 	Timestamp int64  `json:"timestamp"`
@@ -56,10 +62,25 @@ func (t Transaction) VerifyTxn() bool {
 		return false
 	}
 
+	// value and fee are debited together and must not wrap around
+	if t.Value+t.Fee < t.Value {
+		return false
+	}
+
 	if t.From == t.To {
 		return false
 	}
 
+	// the signing key has to be the one that owns the From address, under
+	// either the address of its full width hex or the one older wallets
+	// derived from it
+	if t.PublicKey == "" {
+		return false
+	}
+	if GetAddressFromPublicKeyHex(t.PublicKey) != t.From && GetLegacyAddressFromPublicKeyHex(t.PublicKey) != t.From {
+		return false
+	}
+
 	valid := t.VerifySignature()
 	if !valid {
 		return false
@@ -77,24 +98,75 @@ func (t Transaction) VerifySignature() bool {
 		return false
 	}
 
-	signature := t.Signature
-	publicKeyHex := t.PublicKey
+	publicKeyEcdsa, err := GetPublicKeyFromHex(t.PublicKey)
+	if err != nil {
+		return false
+	}
+	hash := t.SigningHash()
 
-	// Create a copy of the transaction to verify
-	txnCopy := t
-	txnCopy.Signature = []byte{}
-	txnCopy.PublicKey = ""
+	valid := ecdsa.VerifyASN1(publicKeyEcdsa, hash[:], t.Signature)
+	return valid
+}
 
-	publicKeyEcdsa := GetPublicKeyFromHex(publicKeyHex)
+// SigningPayload is the byte string a wallet signs for the transaction:
+//
+//	version    1 byte   TXN_SIGNING_VERSION
+//	chain id   8 bytes  CHAIN_ID
+//	nonce      8 bytes
+//	from       4 byte length, then the address
+//	to         4 byte length, then the address
+//	value      8 bytes
+//	fee        8 bytes
+//	timestamp  8 bytes
+//	data       4 byte length, then the data
+//
+// Integers and lengths are big endian. Status, PublicKey and Signature are
+// not part of the payload.
+func (t Transaction) SigningPayload() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(constants.TXN_SIGNING_VERSION)
+	binary.Write(&buf, binary.BigEndian, uint64(constants.CHAIN_ID))
+	binary.Write(&buf, binary.BigEndian, t.Nonce)
+	writeLengthPrefixed(&buf, []byte(t.From))
+	writeLengthPrefixed(&buf, []byte(t.To))
+	binary.Write(&buf, binary.BigEndian, t.Value)
+	binary.Write(&buf, binary.BigEndian, t.Fee)
+	binary.Write(&buf, binary.BigEndian, t.Timestamp)
+	writeLengthPrefixed(&buf, t.Data)
+	return buf.Bytes()
+}
 
-	bs, _ := json.Marshal(txnCopy)
-	hash := sha256.Sum256(bs)
+func writeLengthPrefixed(buf *bytes.Buffer, b []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(b)))
+	buf.Write(b)
+}
 
-	valid := ecdsa.VerifyASN1(publicKeyEcdsa, hash[:], signature)
-	return valid
+// SigningHash is the SHA-256 of SigningPayload, the digest that is signed.
+func (t Transaction) SigningHash() [32]byte {
+	return sha256.Sum256(t.SigningPayload())
 }
 
+// Cost is what the transaction takes from its sender: the value plus the
+// fee paid to the miner.
+func (t Transaction) Cost() uint64 {
+	return t.Value + t.Fee
+}
+
+// Size is the length of the transaction in its JSON wire form.
+func (t Transaction) Size() int {
+	bs, _ := json.Marshal(t)
+	return len(bs)
+}
+
+// FeeRate is the fee paid per byte of the transaction.
+func (t Transaction) FeeRate() float64 {
+	return float64(t.Fee) / float64(t.Size())
+}
+
+// Hash identifies the transaction. Status is left out because it changes as
+// the transaction moves from the pool into a block.
 func (t Transaction) Hash() string {
+	t.Status = ""
 	bs, _ := json.Marshal(t)
 	sum := sha256.Sum256(bs)
 	hexRep := hex.EncodeToString(sum[:32])
@@ -103,19 +175,51 @@ func (t Transaction) Hash() string {
 	return formattedHexRep
 }
 
-func GetPublicKeyFromHex(publicKeyHex string) *ecdsa.PublicKey {
-	rpk := publicKeyHex[2:]
-	xHex := rpk[:64]
-	yHex := rpk[64:]
-	x := new(big.Int)
-	y := new(big.Int)
-	x.SetString(xHex, 16)
-	y.SetString(yHex, 16)
+// merkleLeaf is what the transaction contributes to the Merkle root of its
+// block: its hash followed by its status.
+func (t Transaction) merkleLeaf() []byte {
+	hash, _ := hex.DecodeString(strings.TrimPrefix(t.Hash(), constants.HEX_PREFIX))
+	return append(hash, t.Status...)
+}
 
-	var npk ecdsa.PublicKey
-	npk.Curve = elliptic.P256()
-	npk.X = x
-	npk.Y = y
+// GetAddressFromPublicKeyHex derives the address owned by a public key given
+// in the 0x prefixed hex form of Wallet.GetPublicKeyHex.
+func GetAddressFromPublicKeyHex(publicKeyHex string) string {
+	hash := sha256.Sum256([]byte(strings.TrimPrefix(publicKeyHex, constants.HEX_PREFIX)))
+	hexRep := hex.EncodeToString(hash[:])
+	return constants.ADDRESS_PREFIX + hexRep[len(hexRep)-40:]
+}
 
-	return &npk
+// GetLegacyAddressFromPublicKeyHex derives the address older wallets gave
+// the public key. They wrote X and Y without leading zeros, so about one key
+// in eight got another address than the one GetAddressFromPublicKeyHex
+// derives; funds sent there stay spendable with the same key. It returns ""
+// for a key GetPublicKeyFromHex refuses.
+func GetLegacyAddressFromPublicKeyHex(publicKeyHex string) string {
+	pub, err := GetPublicKeyFromHex(publicKeyHex)
+	if err != nil {
+		return ""
+	}
+	return GetAddressFromPublicKeyHex(fmt.Sprintf("%x%x", pub.X, pub.Y))
+}
+
+// GetPublicKeyFromHex parses a P-256 public key in the form of
+// Wallet.GetPublicKeyHex: 0x followed by X and Y as 64 hex digits each. It
+// fails on anything else, and on a point that is not on the curve.
+func GetPublicKeyFromHex(publicKeyHex string) (*ecdsa.PublicKey, error) {
+	rpk := strings.TrimPrefix(publicKeyHex, constants.HEX_PREFIX)
+	if len(rpk) != 128 || len(rpk) == len(publicKeyHex) {
+		return nil, fmt.Errorf("public key %q is not 0x followed by 128 hex digits", publicKeyHex)
+	}
+	x, okX := new(big.Int).SetString(rpk[:64], 16)
+	y, okY := new(big.Int).SetString(rpk[64:], 16)
+	if !okX || !okY {
+		return nil, fmt.Errorf("public key %q is not hex", publicKeyHex)
+	}
+
+	curve := elliptic.P256()
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("public key %q is not a point on P-256", publicKeyHex)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
 }
@@ -0,0 +1,171 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// signingVectors mirrors testdata/txn_signing_vectors.json. Wallets written
+// in other languages can check their encoder against the same file.
+type signingVectors struct {
+	PublicKey string `json:"public_key"`
+	Address   string `json:"address"`
+	Vectors   []struct {
+		From        string `json:"from"`
+		To          string `json:"to"`
+		Value       uint64 `json:"value"`
+		Fee         uint64 `json:"fee"`
+		Nonce       uint64 `json:"nonce"`
+		Timestamp   int64  `json:"timestamp"`
+		Data        string `json:"data"`
+		Payload     string `json:"payload"`
+		SigningHash string `json:"signing_hash"`
+		Signature   string `json:"signature"`
+	} `json:"vectors"`
+}
+
+func loadSigningVectors(t *testing.T) *signingVectors {
+	data, err := os.ReadFile("testdata/txn_signing_vectors.json")
+	if err != nil {
+		t.Fatalf("Failed to read signing vectors: %v", err)
+	}
+	var sv signingVectors
+	if err := json.Unmarshal(data, &sv); err != nil {
+		t.Fatalf("Failed to parse signing vectors: %v", err)
+	}
+	return &sv
+}
+
+func TestSigningPayloadGoldenVectors(t *testing.T) {
+	sv := loadSigningVectors(t)
+
+	if address := GetAddressFromPublicKeyHex(sv.PublicKey); address != sv.Address {
+		t.Fatalf("Expected public key to derive %s but got %s", sv.Address, address)
+	}
+
+	for i, v := range sv.Vectors {
+		data, _ := hex.DecodeString(v.Data)
+		signature, _ := hex.DecodeString(v.Signature)
+		txn := Transaction{
+			From:      v.From,
+			To:        v.To,
+			Value:     v.Value,
+			Fee:       v.Fee,
+			Nonce:     v.Nonce,
+			Timestamp: v.Timestamp,
+			Data:      data,
+			Status:    "ignored by the payload",
+			PublicKey: sv.PublicKey,
+			Signature: signature,
+		}
+
+		if payload := hex.EncodeToString(txn.SigningPayload()); payload != v.Payload {
+			t.Errorf("vector %d: payload mismatch\n got %s\nwant %s", i, payload, v.Payload)
+		}
+		hash := txn.SigningHash()
+		if hex.EncodeToString(hash[:]) != v.SigningHash {
+			t.Errorf("vector %d: expected signing hash %s but got %x", i, v.SigningHash, hash)
+		}
+		if !txn.VerifyTxn() {
+			t.Errorf("vector %d: expected the signature to verify", i)
+		}
+
+		tampered := txn
+		tampered.Value++
+		if tampered.VerifyTxn() {
+			t.Errorf("vector %d: expected a changed value to break the signature", i)
+		}
+		tampered = txn
+		tampered.Fee++
+		if tampered.VerifyTxn() {
+			t.Errorf("vector %d: expected a changed fee to break the signature", i)
+		}
+	}
+}
+
+func TestGetPublicKeyFromHex(t *testing.T) {
+	sv := loadSigningVectors(t)
+	if _, err := GetPublicKeyFromHex(sv.PublicKey); err != nil {
+		t.Fatalf("Expected the vector key to parse, got %v", err)
+	}
+
+	offCurve := sv.PublicKey[:len(sv.PublicKey)-1] + "0"
+	if offCurve == sv.PublicKey {
+		offCurve = sv.PublicKey[:len(sv.PublicKey)-1] + "1"
+	}
+	for _, key := range []string{"", "0x", "0x1234", sv.PublicKey[2:], sv.PublicKey + "00", "0x" + strings.Repeat("zz", 64), offCurve} {
+		if _, err := GetPublicKeyFromHex(key); err == nil {
+			t.Errorf("Expected public key %q to be refused", key)
+		}
+	}
+}
+
+func TestVerifyTxnNeedsFromToMatchKey(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	txn := alice.sign(t, "carol", 10, 1, 0)
+	if !txn.VerifyTxn() {
+		t.Fatal("Expected alice's own txn to verify")
+	}
+
+	// a valid signature of alice's key does not spend from bob's account
+	txn.From = bob.address
+	hash := txn.SigningHash()
+	sig, err := ecdsa.SignASN1(rand.Reader, alice.private, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Signature = sig
+	if txn.VerifyTxn() {
+		t.Error("Expected a txn whose sender is not the address of its key to be refused")
+	}
+}
+
+func TestVerifyTxnFromLegacyAddress(t *testing.T) {
+	// older wallets wrote X and Y without leading zeros, which only changes
+	// the address of a key with a coordinate below 2^252
+	var short, full *testKey
+	for i := 0; i < 1000 && (short == nil || full == nil); i++ {
+		k := newTestKey(t)
+		if k.private.X.BitLen() <= 252 || k.private.Y.BitLen() <= 252 {
+			short = k
+		} else {
+			full = k
+		}
+	}
+	if short == nil || full == nil {
+		t.Fatal("Expected to find keys with and without leading zeros")
+	}
+
+	if got := GetLegacyAddressFromPublicKeyHex(full.publicHex); got != full.address {
+		t.Errorf("Expected a key without leading zeros to keep address %s but got %s", full.address, got)
+	}
+	legacy := GetLegacyAddressFromPublicKeyHex(short.publicHex)
+	if legacy == short.address {
+		t.Fatalf("Expected a key with leading zeros to have had another address than %s", short.address)
+	}
+
+	// funds at the old address stay spendable with the same key
+	txn := short.sign(t, "carol", 10, 1, 0)
+	txn.From = legacy
+	hash := txn.SigningHash()
+	sig, err := ecdsa.SignASN1(rand.Reader, short.private, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Signature = sig
+	if !txn.VerifyTxn() {
+		t.Error("Expected a txn from the legacy address of its key to verify")
+	}
+	if !short.sign(t, "carol", 10, 1, 0).VerifyTxn() {
+		t.Error("Expected a txn from the full width address of its key to verify")
+	}
+
+	if got := GetLegacyAddressFromPublicKeyHex("0x1234"); got != "" {
+		t.Errorf("Expected no legacy address for a malformed key, got %s", got)
+	}
+}
@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"KNIRVCHAIN-MAIN/constants"
+	"KNIRVCHAIN-MAIN/merkle"
+	"KNIRVCHAIN-MAIN/merkle/txnproof"
+)
+
+// ErrNoMerkleRoot is returned for a transaction of a block from before
+// Merkle roots, which nothing short of the whole block proves.
+var ErrNoMerkleRoot = txnproof.ErrNoMerkleRoot
+
+// TxnProof shows a transaction is in a block without the rest of the
+// block: the branch from the transaction up to the Merkle root of the
+// block header. A light client that has no use for the transaction itself
+// can decode and verify the txnproof.Proof alone.
+type TxnProof struct {
+	Transaction *Transaction `json:"transaction"`
+	txnproof.Proof
+}
+
+// GetTxnProof proves the transaction with hash is in our chain. It returns
+// ErrNotFound when no block of our chain has it.
+func (bc *BlockchainStruct) GetTxnProof(hash string) (*TxnProof, error) {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+
+	location, err := GetTxnLocation(bc.Store, hash)
+	if err != nil {
+		return nil, err
+	}
+	height := uint64(len(bc.Blocks))
+	if location.BlockNumber >= height {
+		return nil, ErrNotFound
+	}
+	b, err := GetBlockByNumber(bc.Store, location.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if b.MerkleRoot == "" {
+		return nil, ErrNoMerkleRoot
+	}
+
+	steps, err := merkle.Proof(b.merkleLeaves(), location.Index)
+	if err != nil {
+		return nil, err
+	}
+	branch := make([]txnproof.Step, len(steps))
+	for i, step := range steps {
+		branch[i] = txnproof.Step{Hash: constants.HEX_PREFIX + hex.EncodeToString(step.Hash), Left: step.Left}
+	}
+
+	return &TxnProof{
+		Transaction: b.Transactions[location.Index],
+		Proof: txnproof.Proof{
+			Index:         location.Index,
+			Branch:        branch,
+			Header:        txnproof.Header{BlockHeader: txnproof.BlockHeader(b.BlockHeader), Hash: b.Hash()},
+			Confirmations: height - location.BlockNumber,
+		},
+	}, nil
+}
+
+// Verify checks that p carries the transaction with hash, that the
+// transaction succeeded, and that the proof holds as txnproof.Proof.Verify
+// checks it.
+func (p *TxnProof) Verify(hash string) error {
+	if p.Transaction == nil {
+		return errors.New("proof carries no transaction")
+	}
+	if got := p.Transaction.Hash(); got != hash {
+		return fmt.Errorf("proof is for transaction %s, not %s", got, hash)
+	}
+	if p.Transaction.Status != constants.SUCCESS {
+		return fmt.Errorf("transaction %s has status %q", hash, p.Transaction.Status)
+	}
+	return p.Proof.Verify(hash)
+}
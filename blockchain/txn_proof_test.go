@@ -0,0 +1,131 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+func TestTxnProof(t *testing.T) {
+	bc := NewBlockchain(NewMemoryStore(), *NewBlock("0x0", 0, 0), "", nil, nil)
+	funding := nextBlock(t, bc.Blocks[0], "alice", false)
+	for _, address := range []string{"carol", "dave"} {
+		reward := NewTransaction(constants.BLOCKCHAIN_ADDRESS, address, constants.MINING_REWARD, []byte{})
+		reward.Status = constants.SUCCESS
+		funding.Transactions = append(funding.Transactions, reward)
+	}
+	funding.SetMerkleRoot()
+	bc.AddBlock(funding)
+
+	txns := []*Transaction{pendingTxn("alice", 0, 1), pendingTxn("carol", 0, 2), pendingTxn("dave", 0, 3)}
+	for _, txn := range txns {
+		txn.Status = constants.SUCCESS
+	}
+	b := nextBlock(t, funding, "miner", false, txns...)
+	b.Bits = constants.POW_LIMIT_BITS
+	if err := b.Mine(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	bc.AddBlock(b)
+
+	for i, txn := range b.Transactions {
+		proof, err := bc.GetTxnProof(txn.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proof.Index != i || proof.Header.Hash != b.Hash() {
+			t.Errorf("Expected transaction %d of block %s, got %d of %s", i, b.Hash(), proof.Index, proof.Header.Hash)
+		}
+
+		// the proof is checked as a wallet receives it
+		data, _ := json.Marshal(proof)
+		var received TxnProof
+		if err := json.Unmarshal(data, &received); err != nil {
+			t.Fatal(err)
+		}
+		if err := received.Verify(txn.Hash()); err != nil {
+			t.Errorf("Expected the proof of transaction %d to verify, got %v", i, err)
+		}
+	}
+
+	proof, err := bc.GetTxnProof(txns[1].Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proof.Verify(txns[0].Hash()); err == nil {
+		t.Error("Expected a proof of another transaction to be refused")
+	}
+
+	proof.Transaction.Status = constants.FAILED
+	if err := proof.Verify(txns[1].Hash()); err == nil {
+		t.Error("Expected a transaction with another status to be refused")
+	}
+	proof.Transaction.Status = constants.SUCCESS
+
+	// the wallet has no use for the transaction, so the proof must hold on
+	// its own
+	if err := proof.Proof.Verify(txns[0].Hash()); err == nil {
+		t.Error("Expected the branch of one transaction not to prove another")
+	}
+
+	proof.Branch[0].Left = !proof.Branch[0].Left
+	if err := proof.Verify(txns[1].Hash()); err == nil {
+		t.Error("Expected a broken branch to be refused")
+	}
+	proof.Branch[0].Left = !proof.Branch[0].Left
+
+	proof.Header.MerkleRoot = b.Transactions[0].Hash()
+	if err := proof.Verify(txns[1].Hash()); err == nil {
+		t.Error("Expected a header that does not hash to its claimed hash to be refused")
+	}
+	proof.Header.MerkleRoot = b.MerkleRoot
+
+	// a target above the limit would let any header through
+	proof.Header.Bits = 0x2100ffff
+	proof.Header.Hash = Block{BlockHeader: BlockHeader(proof.Header.BlockHeader)}.Hash()
+	if err := proof.Verify(txns[1].Hash()); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("Expected a header with a target above the limit to be refused, got %v", err)
+	}
+
+	if _, err := bc.GetTxnProof("0xmissing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for an unknown transaction, got %v", err)
+	}
+}
+
+func TestTxnProofOfFailedTxn(t *testing.T) {
+	bc := NewBlockchain(NewMemoryStore(), *NewBlock("0x0", 0, 0), "", nil, nil)
+	failed := pendingTxn("alice", 0, 1)
+	failed.Status = constants.FAILED
+	b := nextBlock(t, bc.Blocks[0], "miner", false, failed)
+	b.Bits = constants.POW_LIMIT_BITS
+	if err := b.Mine(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	bc.AddBlock(b)
+
+	// the block has the transaction, but did not carry out the payment
+	proof, err := bc.GetTxnProof(failed.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proof.Verify(failed.Hash()); err == nil || !strings.Contains(err.Error(), "status") {
+		t.Errorf("Expected the proof of a failed transaction to be refused, got %v", err)
+	}
+	if err := proof.Proof.Verify(failed.Hash()); err == nil {
+		t.Error("Expected the branch of a failed transaction not to prove it succeeded")
+	}
+}
+
+func TestTxnProofLegacyBlock(t *testing.T) {
+	bc := NewBlockchain(NewMemoryStore(), *NewBlock("0x0", 0, 0), "", nil, nil)
+	legacy := nextBlock(t, bc.Blocks[0], "miner", false)
+	legacy.MerkleRoot = ""
+	bc.AddBlock(legacy)
+
+	if _, err := bc.GetTxnProof(legacy.Transactions[0].Hash()); err != ErrNoMerkleRoot {
+		t.Errorf("Expected ErrNoMerkleRoot for a block without a merkle root, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package blockchain
+
+import (
+	"fmt"
+	"time"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+// ValidateBlock reports whether b is a valid next block for our chain: it
+// has to link to our head, carry a timestamp after the median time of the
+// blocks before it and not far in the future, carry the target our retarget
+// rule expects, meet the proof of work, match the Merkle root of its
+// header, stay within our block limits, carry only transactions that are
+// signed by their sender, in nonce order and covered by the sender's
+// balance, and pay the miner exactly the reward plus the fees.
+func (bc *BlockchainStruct) ValidateBlock(b *Block) error {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+
+	return bc.validateBlock(newAccountState(bc.Store), bc.Blocks, b)
+}
+
+// ValidateChainSegment reports whether blocks, a whole chain or a segment
+// that hangs off ours, are valid. The blocks we already have are skipped;
+// the rest are checked like ValidateBlock, each on top of the one before,
+// starting from the state of our chain at the common ancestor. A chain
+// from another genesis block is refused with ErrForeignGenesis.
+func (bc *BlockchainStruct) ValidateChainSegment(blocks []*Block) error {
+	bc.Mutex.Lock()
+	defer bc.Mutex.Unlock()
+
+	return bc.validateChainSegment(blocks)
+}
+
+func (bc *BlockchainStruct) validateChainSegment(blocks []*Block) error {
+	shared, err := bc.forkPoint(blocks)
+	if err != nil {
+		return err
+	}
+	if shared == len(blocks) {
+		return nil
+	}
+
+	fork := blocks[shared].BlockNumber
+	state, err := bc.stateAt(fork)
+	if err != nil {
+		return err
+	}
+
+	chain := append([]*Block{}, bc.Blocks[:fork]...)
+	for _, b := range blocks[shared:] {
+		if err := bc.validateBlock(state, chain, b); err != nil {
+			return err
+		}
+		chain = append(chain, b)
+	}
+	return nil
+}
+
+// stateAt returns the accounts as they were before block number of our
+// chain, by reverting the blocks from our head down to it.
+func (bc *BlockchainStruct) stateAt(number uint64) (*accountState, error) {
+	state := newAccountState(bc.Store)
+	if number == 0 {
+		state.rebuild = true
+		return state, nil
+	}
+
+	for i := len(bc.Blocks) - 1; i >= int(number); i-- {
+		txns := bc.Blocks[i].Transactions
+		for j := len(txns) - 1; j >= 0; j-- {
+			if err := state.revertTxn(txns[j]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return state, nil
+}
+
+// validateBlock checks b on top of chain, which runs from a genesis block
+// up to the parent of b, and applies it to state. On an empty chain b has to
+// be a genesis block, which carries no transactions and needs no proof of
+// work.
+func (bc *BlockchainStruct) validateBlock(state *accountState, chain []*Block, b *Block) error {
+	if len(chain) == 0 {
+		if b.BlockNumber != 0 {
+			return fmt.Errorf("block %d: expected a genesis block", b.BlockNumber)
+		}
+		if len(b.Transactions) > 0 {
+			return fmt.Errorf("block 0: genesis block carries %d transactions", len(b.Transactions))
+		}
+		return nil
+	}
+
+	prev := chain[len(chain)-1]
+	if b.BlockNumber != prev.BlockNumber+1 {
+		return fmt.Errorf("block %d follows block %d", b.BlockNumber, prev.BlockNumber)
+	}
+	if b.PrevHash != prev.Hash() {
+		return fmt.Errorf("block %d: previous hash %s does not match block %d", b.BlockNumber, b.PrevHash, prev.BlockNumber)
+	}
+	if err := checkTimestamp(chain, b, time.Now()); err != nil {
+		return fmt.Errorf("block %d: %w", b.BlockNumber, err)
+	}
+	// without bits the block would fall back to the target of blocks from
+	// before targets
+	if expected := bc.Retarget.NextBits(chain); b.Bits != expected {
+		return fmt.Errorf("block %d: target bits %08x, expected %08x", b.BlockNumber, b.Bits, expected)
+	}
+	// the proof of work goes before anything in the body, so a block
+	// nobody mined costs us no more than a hash
+	if hash := b.Hash(); !meetsProofOfWork(hash, b.Target()) {
+		return fmt.Errorf("block %d: hash %s does not meet the proof of work", b.BlockNumber, hash)
+	}
+	if err := b.checkMerkleRoot(); err != nil {
+		return err
+	}
+
+	if err := bc.Limits.Check(b); err != nil {
+		return err
+	}
+	if err := validateBlockTxns(b); err != nil {
+		return err
+	}
+	return state.checkBlock(b)
+}
+
+// validateBlockTxns checks that every transaction of b but the reward
+// succeeded and carries a valid signature, and that its last transaction,
+// and only that one, is the reward, paying MINING_REWARD plus their fees.
+// A failed transaction is refused: its hash leaves out the status, so it
+// would stand in for the real one in the index and the pool.
+func validateBlockTxns(b *Block) error {
+	if len(b.Transactions) == 0 {
+		return fmt.Errorf("block %d has no reward", b.BlockNumber)
+	}
+
+	var fees uint64
+	last := len(b.Transactions) - 1
+	for i, txn := range b.Transactions[:last] {
+		if txn.From == constants.BLOCKCHAIN_ADDRESS {
+			return fmt.Errorf("block %d: transaction %d is minted by the faucet", b.BlockNumber, i)
+		}
+		if txn.Status != constants.SUCCESS {
+			return fmt.Errorf("block %d: transaction %s has status %q", b.BlockNumber, txn.Hash(), txn.Status)
+		}
+		if !txn.VerifyTxn() {
+			return fmt.Errorf("block %d: transaction %s does not verify", b.BlockNumber, txn.Hash())
+		}
+		if fees+txn.Fee < fees {
+			return fmt.Errorf("block %d: fees overflow", b.BlockNumber)
+		}
+		fees += txn.Fee
+	}
+
+	reward := b.Transactions[last]
+	if reward.From != constants.BLOCKCHAIN_ADDRESS || reward.Status != constants.SUCCESS {
+		return fmt.Errorf("block %d has no reward", b.BlockNumber)
+	}
+	if reward.Value != constants.MINING_REWARD+fees {
+		return fmt.Errorf("block %d: reward of %d, expected %d", b.BlockNumber, reward.Value, constants.MINING_REWARD+fees)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+type testKey struct {
+	private   *ecdsa.PrivateKey
+	publicHex string
+	address   string
+}
+
+func newTestKey(t *testing.T) *testKey {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicHex := fmt.Sprintf("0x%064x%064x", private.PublicKey.X, private.PublicKey.Y)
+	return &testKey{private: private, publicHex: publicHex, address: GetAddressFromPublicKeyHex(publicHex)}
+}
+
+func (k *testKey) sign(t *testing.T, to string, value, fee, nonce uint64) *Transaction {
+	txn := NewTransaction(k.address, to, value, []byte{})
+	txn.Fee = fee
+	txn.Nonce = nonce
+	hash := txn.SigningHash()
+	sig, err := ecdsa.SignASN1(rand.Reader, k.private, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Signature = sig
+	txn.PublicKey = k.publicHex
+	txn.Status = constants.SUCCESS
+	return txn
+}
+
+// testBits is a target about one hash in 4096 meets, so chains built on
+// testGenesis are mined in no time.
+const testBits = 0x1f0fffff
+
+func testGenesis() *Block {
+	genesis := NewBlock("0x0", 0, 0)
+	genesis.Bits = testBits
+	return genesis
+}
+
+// nextBlock builds the block after prev carrying txns and a reward for
+// miner that collects their fees, at the target of prev. It is mined only
+// when mine is set.
+func nextBlock(t *testing.T, prev *Block, miner string, mine bool, txns ...*Transaction) *Block {
+	b := NewBlock(prev.Hash(), 0, prev.BlockNumber+1)
+	b.Bits = prev.Bits
+	var fees uint64
+	for _, txn := range txns {
+		b.Transactions = append(b.Transactions, txn)
+		fees += txn.Fee
+	}
+	reward := NewTransaction(constants.BLOCKCHAIN_ADDRESS, miner, constants.MINING_REWARD+fees, []byte{})
+	reward.Status = constants.SUCCESS
+	b.Transactions = append(b.Transactions, reward)
+	b.SetMerkleRoot()
+	if mine {
+		mineBlock(t, b)
+	}
+	return b
+}
+
+// mineBlock commits b to its transactions as they are now and mines it.
+func mineBlock(t *testing.T, b *Block) {
+	b.SetMerkleRoot()
+	if err := b.Mine(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateChainSegment(t *testing.T) {
+	alice := newTestKey(t)
+	bc := NewBlockchain(NewMemoryStore(), *testGenesis(), "", nil, nil)
+	genesis := bc.Blocks[0]
+
+	b1 := nextBlock(t, genesis, alice.address, true)
+	bc.AddBlock(b1)
+	spend := alice.sign(t, "bob", 500, 20, 0)
+	b2 := nextBlock(t, b1, "miner", true, spend)
+
+	if err := bc.ValidateChainSegment([]*Block{genesis, b1, b2}); err != nil {
+		t.Fatalf("Expected the chain to validate, got %v", err)
+	}
+	if err := bc.ValidateBlock(b2); err != nil {
+		t.Fatalf("Expected block 2 to validate, got %v", err)
+	}
+
+	unmined := nextBlock(t, b1, "miner", true, spend)
+	for meetsProofOfWork(unmined.Hash(), unmined.Target()) {
+		unmined.Nonce++
+	}
+	if err := bc.ValidateBlock(unmined); err == nil || !strings.Contains(err.Error(), "proof of work") {
+		t.Errorf("Expected a block without proof of work to be refused, got %v", err)
+	}
+
+	swapped := nextBlock(t, b1, "miner", true, spend)
+	swapped.Transactions[0] = alice.sign(t, "carol", 500, 20, 0)
+	if err := bc.ValidateBlock(swapped); err == nil || !strings.Contains(err.Error(), "merkle root") {
+		t.Errorf("Expected a body its header does not commit to to be refused, got %v", err)
+	}
+
+	rootless := nextBlock(t, b1, "miner", false, spend)
+	rootless.MerkleRoot = ""
+	if err := rootless.Mine(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.ValidateBlock(rootless); err == nil || !strings.Contains(err.Error(), "merkle root") {
+		t.Errorf("Expected a block without a merkle root to be refused, got %v", err)
+	}
+
+	bitless := nextBlock(t, b1, "miner", false, spend)
+	bitless.Bits = 0
+	if err := bc.ValidateBlock(bitless); err == nil || !strings.Contains(err.Error(), "target bits") {
+		t.Errorf("Expected a block without target bits to be refused, got %v", err)
+	}
+
+	greedy := nextBlock(t, b1, "miner", false)
+	greedy.Transactions[0].Value++
+	mineBlock(t, greedy)
+	if err := bc.ValidateBlock(greedy); err == nil || !strings.Contains(err.Error(), "reward") {
+		t.Errorf("Expected a reward above the fees to be refused, got %v", err)
+	}
+
+	tampered := *spend
+	tampered.Value++
+	forged := nextBlock(t, b1, "miner", true, &tampered)
+	if err := bc.ValidateChainSegment([]*Block{b1, forged}); err == nil || !strings.Contains(err.Error(), "does not verify") {
+		t.Errorf("Expected a transaction with a broken signature to be refused, got %v", err)
+	}
+
+	// a failed copy of alice's txn, with no signature, must not take the
+	// place of the real one
+	failed := *spend
+	failed.Signature = nil
+	failed.Status = constants.FAILED
+	stolen := nextBlock(t, b1, "miner", true, &failed)
+	if err := bc.ValidateChainSegment([]*Block{b1, stolen}); err == nil || !strings.Contains(err.Error(), "status") {
+		t.Errorf("Expected a failed transaction to be refused, got %v", err)
+	}
+
+	overdraft := nextBlock(t, b1, "miner", true, alice.sign(t, "bob", constants.MINING_REWARD, 1, 0))
+	if err := bc.ValidateChainSegment([]*Block{b1, overdraft}); err == nil || !strings.Contains(err.Error(), "insufficient balance") {
+		t.Errorf("Expected a transaction its sender cannot cover to be refused, got %v", err)
+	}
+
+	replayed := nextBlock(t, b1, "miner", true, spend, spend)
+	if err := bc.ValidateChainSegment([]*Block{b1, replayed}); err == nil || !strings.Contains(err.Error(), "nonce too low") {
+		t.Errorf("Expected a reused nonce to be refused, got %v", err)
+	}
+
+	stranger := nextBlock(t, b2, "miner", false)
+	stranger.BlockNumber = 5
+	if err := bc.ValidateChainSegment([]*Block{stranger}); err != ErrUnconnectedChain {
+		t.Errorf("Expected an unconnected segment to be refused, got %v", err)
+	}
+
+	// once block 2 is ours, a rival for it is checked against the accounts
+	// as they were before it, so spending the same funds again is fine
+	bc.AddBlock(b2)
+	rival := nextBlock(t, b1, "miner", true, alice.sign(t, "carol", 700, 0, 0))
+	if err := bc.ValidateChainSegment([]*Block{b1, rival}); err != nil {
+		t.Errorf("Expected the rival to validate, got %v", err)
+	}
+}
+
+func TestValidateBlockMalformedKey(t *testing.T) {
+	bc := NewBlockchain(NewMemoryStore(), *testGenesis(), "", nil, nil)
+
+	// a key too short to split must not bring down the node, whether or
+	// not the block was mined
+	txn := NewTransaction(GetAddressFromPublicKeyHex("0x1234"), "bob", 10, []byte{})
+	txn.PublicKey = "0x1234"
+	txn.Signature = []byte{1}
+	txn.Status = constants.SUCCESS
+	for _, mine := range []bool{false, true} {
+		b := nextBlock(t, bc.Blocks[0], "miner", mine, txn)
+		if err := bc.ValidateChainSegment([]*Block{bc.Blocks[0], b}); err == nil {
+			t.Errorf("Expected a block with a malformed key to be refused (mined: %v)", mine)
+		}
+	}
+}
@@ -2,11 +2,14 @@ package blockchainserver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"KNIRVCHAIN-MAIN/blockchain"
 	"KNIRVCHAIN-MAIN/constants"
@@ -16,7 +19,8 @@ type BlockchainServer struct {
 	Port          uint64                       `json:"port"`
 	BlockchainPtr *blockchain.BlockchainStruct `json:"blockchain"`
 	Server        *http.Server
-	MiningLocked  bool `json:"mining_locked"`
+	MiningLocked  bool               `json:"mining_locked"`
+	Syncer        *blockchain.Syncer `json:"-"`
 }
 
 func NewBlockchainServer(port uint64, blockchainPtr *blockchain.BlockchainStruct) *BlockchainServer {
@@ -47,10 +51,15 @@ func (bcs *BlockchainServer) GetBalance(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "application/json")
 	if r.Method == http.MethodGet {
 		addr := r.URL.Query().Get("address")
+		account, err := bcs.BlockchainPtr.GetAccount(addr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		x := struct {
 			Balance uint64 `json:"balance"`
 		}{
-			bcs.BlockchainPtr.CalculateTotalCrypto(addr),
+			account.Balance,
 		}
 
 		mBalance, err := json.Marshal(x)
@@ -81,9 +90,197 @@ func (bcs *BlockchainServer) GetAllNonRewardedTxns(w http.ResponseWriter, r *htt
 	}
 }
 
+// GetNonce serves GET /nonce?address=, the nonce the next transaction of
+// the address has to carry.
+func (bcs *BlockchainServer) GetNonce(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		addr := r.URL.Query().Get("address")
+		nonce, err := bcs.BlockchainPtr.NextNonce(addr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		x := struct {
+			Address string `json:"address"`
+			Nonce   uint64 `json:"nonce"`
+		}{
+			addr,
+			nonce,
+		}
+
+		mNonce, err := json.Marshal(x)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(mNonce)
+	} else {
+		http.Error(w, "Invalid Method", http.StatusBadRequest)
+	}
+}
+
+// GetFeeEstimate serves GET /fee_estimate, the fee per byte paid in recent
+// blocks.
+func (bcs *BlockchainServer) GetFeeEstimate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		mEstimate, err := json.Marshal(bcs.BlockchainPtr.EstimateFee())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(mEstimate)
+	} else {
+		http.Error(w, "Invalid Method", http.StatusBadRequest)
+	}
+}
+
+// GetTransactionByHash serves GET /tx/{hash}, and GET /tx/{hash}/proof
+// through GetTxnProof.
+func (bcs *BlockchainServer) GetTransactionByHash(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/proof") {
+		bcs.GetTxnProof(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		hash := strings.TrimPrefix(r.URL.Path, "/tx/")
+		if hash == "" {
+			http.Error(w, "Missing transaction hash", http.StatusBadRequest)
+			return
+		}
+
+		receipt, err := bcs.BlockchainPtr.GetTransactionByHash(hash)
+		if err == blockchain.ErrNotFound {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(receipt); err != nil {
+			http.Error(w, "Failed to marshal transaction to json", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		http.Error(w, "Invalid Method", http.StatusBadRequest)
+	}
+}
+
+// GetTxnProof serves GET /tx/{hash}/proof, the Merkle branch from the
+// transaction up to the header of its block, and that header.
+func (bcs *BlockchainServer) GetTxnProof(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		hash := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/tx/"), "/proof")
+		if hash == "" {
+			http.Error(w, "Missing transaction hash", http.StatusBadRequest)
+			return
+		}
+
+		proof, err := bcs.BlockchainPtr.GetTxnProof(hash)
+		if err == blockchain.ErrNotFound {
+			http.Error(w, "Transaction not found in a block", http.StatusNotFound)
+			return
+		}
+		if err == blockchain.ErrNoMerkleRoot {
+			http.Error(w, "Block of the transaction has no merkle root", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(proof); err != nil {
+			http.Error(w, "Failed to marshal proof to json", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		http.Error(w, "Invalid Method", http.StatusBadRequest)
+	}
+}
+
+// GetAddressTxns serves GET /address/{address}/txns?cursor=&limit=&direction=
+// where direction is "desc" (newest first, the default) or "asc".
+func (bcs *BlockchainServer) GetAddressTxns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		path := strings.TrimPrefix(r.URL.Path, "/address/")
+		if !strings.HasSuffix(path, "/txns") {
+			http.NotFound(w, r)
+			return
+		}
+		address := strings.TrimSuffix(path, "/txns")
+		if address == "" {
+			http.Error(w, "Missing address", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		limit := constants.ADDRESS_TXNS_PAGE_LIMIT
+		if query.Get("limit") != "" {
+			var err error
+			limit, err = strconv.Atoi(query.Get("limit"))
+			if err != nil || limit <= 0 || limit > constants.ADDRESS_TXNS_MAX_LIMIT {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", constants.ADDRESS_TXNS_MAX_LIMIT), http.StatusBadRequest)
+				return
+			}
+		}
+
+		reverse := true
+		switch query.Get("direction") {
+		case "", "desc":
+		case "asc":
+			reverse = false
+		default:
+			http.Error(w, "direction must be asc or desc", http.StatusBadRequest)
+			return
+		}
+
+		page, err := bcs.BlockchainPtr.GetAddressTxns(address, query.Get("cursor"), limit, reverse)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			http.Error(w, "Failed to marshal transactions to json", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		http.Error(w, "Invalid Method", http.StatusBadRequest)
+	}
+}
+
+// GetMempoolStats serves GET /mempool/stats.
+func (bcs *BlockchainServer) GetMempoolStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		mStats, err := json.Marshal(bcs.BlockchainPtr.Mempool.Stats())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(mStats)
+	} else {
+		http.Error(w, "Invalid Method", http.StatusBadRequest)
+	}
+}
+
 func (bcs *BlockchainServer) handleGetTransactions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var transactions = bcs.BlockchainPtr.TransactionPool
+	var transactions = bcs.BlockchainPtr.Mempool.Transactions()
 	w.WriteHeader(http.StatusOK)
 	err := json.NewEncoder(w).Encode(transactions)
 	if err != nil {
@@ -107,6 +304,16 @@ func (bcs *BlockchainServer) SendTxnToTheBlockchain(w http.ResponseWriter, req *
 			return
 		}
 		err := bcs.BlockchainPtr.AddTransaction(txn)
+		var balanceErr *blockchain.InsufficientBalanceError
+		var nonceErr *blockchain.NonceError
+		var senderErr *blockchain.SenderLimitError
+		var replacementErr *blockchain.ReplacementUnderpricedError
+		if errors.As(err, &balanceErr) || errors.As(err, &nonceErr) || errors.As(err, &senderErr) || errors.As(err, &replacementErr) ||
+			errors.Is(err, blockchain.ErrMempoolFull) || errors.Is(err, blockchain.ErrAlreadyKnown) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			log.Printf("Rejected transaction: %v", err)
+			return
+		}
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to add transaction: %v", err), http.StatusInternalServerError)
 			log.Printf("Failed to add transaction: %v", err)
@@ -189,16 +396,182 @@ func (bcs *BlockchainServer) FetchLastNBlocks(w http.ResponseWriter, req *http.R
 	}
 }
 
+// parseRange reads the from and count query parameters of a range request.
+// count defaults to, and may not exceed, limit.
+func parseRange(r *http.Request, limit int) (uint64, int, error) {
+	query := r.URL.Query()
+	from, err := strconv.ParseUint(query.Get("from"), 10, 64)
+	if err != nil {
+		return 0, 0, errors.New("from must be a block number")
+	}
+
+	count := limit
+	if query.Get("count") != "" {
+		count, err = strconv.Atoi(query.Get("count"))
+		if err != nil || count <= 0 || count > limit {
+			return 0, 0, fmt.Errorf("count must be between 1 and %d", limit)
+		}
+	}
+	return from, count, nil
+}
+
+// GetHeaders serves GET /headers?from=&count=, the headers of up to count
+// blocks starting at block number from.
+func (bcs *BlockchainServer) GetHeaders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		from, count, err := parseRange(r, constants.SYNC_HEADERS_LIMIT)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mHeaders, err := json.Marshal(bcs.BlockchainPtr.Headers(from, count))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(mHeaders)
+	} else {
+		http.Error(w, "Invalid Method", http.StatusBadRequest)
+	}
+}
+
+// GetBlocks serves GET /blocks?from=&to=, the blocks numbered from to to,
+// both included. At most BLOCK_RANGE_LIMIT blocks are sent, and no more
+// than fit in BLOCK_RANGE_MAX_BYTES; a caller that gets fewer blocks than it
+// asked for carries on after the last one. from defaults to the genesis
+// block and to to as far as the limit allows.
+func (bcs *BlockchainServer) GetBlocks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		var from uint64
+		if query.Get("from") != "" {
+			var err error
+			from, err = strconv.ParseUint(query.Get("from"), 10, 64)
+			if err != nil {
+				http.Error(w, "from must be a block number", http.StatusBadRequest)
+				return
+			}
+		}
+		to := from + constants.BLOCK_RANGE_LIMIT - 1
+		if query.Get("to") != "" {
+			requested, err := strconv.ParseUint(query.Get("to"), 10, 64)
+			if err != nil || requested < from {
+				http.Error(w, "to must be a block number no lower than from", http.StatusBadRequest)
+				return
+			}
+			if requested < to {
+				to = requested
+			}
+		}
+
+		var size int
+		blocks := []*blockchain.Block{}
+		for _, b := range bcs.BlockchainPtr.BlockRange(from, int(to-from+1)) {
+			size += len(b.ToJson())
+			if size > constants.BLOCK_RANGE_MAX_BYTES && len(blocks) > 0 {
+				break
+			}
+			blocks = append(blocks, b)
+		}
+
+		mBlocks, err := json.Marshal(blocks)
+		if err != nil {
+			http.Error(w, "Failed to marshal blocks to json", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(mBlocks)
+	} else {
+		http.Error(w, "Invalid Method", http.StatusBadRequest)
+	}
+}
+
+// GetBlock serves GET /block/{number} and GET /block/hash/{hash}.
+func (bcs *BlockchainServer) GetBlock(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		path := strings.TrimPrefix(r.URL.Path, "/block/")
+
+		var b *blockchain.Block
+		var err error
+		if strings.HasPrefix(path, "hash/") {
+			hash := strings.TrimPrefix(path, "hash/")
+			if hash == "" {
+				http.Error(w, "Missing block hash", http.StatusBadRequest)
+				return
+			}
+			b, err = blockchain.GetBlockByHash(bcs.BlockchainPtr.Store, hash)
+		} else {
+			number, perr := strconv.ParseUint(path, 10, 64)
+			if perr != nil {
+				http.Error(w, "Block number must be a number", http.StatusBadRequest)
+				return
+			}
+			b, err = blockchain.GetBlockByNumber(bcs.BlockchainPtr.Store, number)
+		}
+		if err == blockchain.ErrNotFound {
+			http.Error(w, "Block not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(b); err != nil {
+			http.Error(w, "Failed to marshal block to json", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		http.Error(w, "Invalid Method", http.StatusBadRequest)
+	}
+}
+
+// GetSyncStatus serves GET /sync_status, the progress of our sync with the
+// peers.
+func (bcs *BlockchainServer) GetSyncStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodGet {
+		status := blockchain.SyncStatus{State: blockchain.SyncIdle}
+		if bcs.Syncer != nil {
+			status = bcs.Syncer.Status()
+		}
+
+		mStatus, err := json.Marshal(status)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(mStatus)
+	} else {
+		http.Error(w, "Invalid Method", http.StatusBadRequest)
+	}
+}
+
 func (bcs *BlockchainServer) Start() {
 	http.HandleFunc("/", bcs.GetBlockchain)
 	http.HandleFunc("/balance", bcs.GetBalance)
-	http.HandleFunc("/blocks", bcs.GetBlockchain)
+	http.HandleFunc("/nonce", bcs.GetNonce)
+	http.HandleFunc("/fee_estimate", bcs.GetFeeEstimate)
+	http.HandleFunc("/blocks", bcs.GetBlocks)
+	http.HandleFunc("/block/", bcs.GetBlock)
 	http.HandleFunc("/get_all_non_rewarded_txns", bcs.GetAllNonRewardedTxns)
 	http.HandleFunc("/send_txn", bcs.SendTxnToTheBlockchain)
 	http.HandleFunc("/transactions", bcs.handleGetTransactions)
+	http.HandleFunc("/mempool/stats", bcs.GetMempoolStats)
+	http.HandleFunc("/tx/", bcs.GetTransactionByHash)
+	http.HandleFunc("/address/", bcs.GetAddressTxns)
 	http.HandleFunc("/send_peers_list", bcs.SendPeersList)
 	http.HandleFunc("/check_status", CheckStatus)
 	http.HandleFunc("/fetch_last_n_blocks", bcs.FetchLastNBlocks)
+	http.HandleFunc("/headers", bcs.GetHeaders)
+	http.HandleFunc("/sync_status", bcs.GetSyncStatus)
 	log.Println("Launching webserver at port :", bcs.Port)
 	go func() {
 		if err := bcs.Server.ListenAndServe(); err != http.ErrServerClosed {
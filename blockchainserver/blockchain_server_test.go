@@ -0,0 +1,130 @@
+package blockchainserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"KNIRVCHAIN-MAIN/blockchain"
+	"KNIRVCHAIN-MAIN/constants"
+)
+
+func TestGetNonce(t *testing.T) {
+	bc := blockchain.NewBlockchain(blockchain.NewMemoryStore(), *blockchain.NewBlock("0x0", 0, 0), "", nil, nil)
+	pending := blockchain.NewTransaction("alice", "bob", 10, []byte{})
+	pending.Status = constants.TXN_VERIFICATION_SUCCESS
+	if err := bc.Mempool.Add(pending); err != nil {
+		t.Fatal(err)
+	}
+	bcs := NewBlockchainServer(0, bc)
+
+	rec := httptest.NewRecorder()
+	bcs.GetNonce(rec, httptest.NewRequest(http.MethodGet, "/nonce?address=alice", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %d: %s", rec.Code, rec.Body)
+	}
+	var got struct {
+		Address string `json:"address"`
+		Nonce   uint64 `json:"nonce"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Address != "alice" || got.Nonce != 1 {
+		t.Errorf("Expected alice's next nonce to count her pending txn, got %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	bcs.GetNonce(rec, httptest.NewRequest(http.MethodPost, "/nonce?address=alice", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a POST to be refused, got %d", rec.Code)
+	}
+}
+
+func TestGetBlocks(t *testing.T) {
+	bc := blockchain.NewBlockchain(blockchain.NewMemoryStore(), *blockchain.NewBlock("0x0", 0, 0), "", nil, nil)
+	for i := 1; i <= constants.BLOCK_RANGE_LIMIT+10; i++ {
+		bc.AddBlock(blockchain.NewBlock(bc.Blocks[i-1].Hash(), 0, uint64(i)))
+	}
+	bcs := NewBlockchainServer(0, bc)
+
+	get := func(target string) ([]*blockchain.Block, int) {
+		rec := httptest.NewRecorder()
+		bcs.GetBlocks(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var blocks []*blockchain.Block
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &blocks); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return blocks, rec.Code
+	}
+
+	blocks, code := get("/blocks?from=3&to=5")
+	if code != http.StatusOK || len(blocks) != 3 || blocks[0].BlockNumber != 3 || blocks[2].Hash() != bc.Blocks[5].Hash() {
+		t.Errorf("Expected blocks 3 to 5, got %d blocks (%d)", len(blocks), code)
+	}
+	if blocks, _ := get("/blocks?from=0&to=1000"); len(blocks) != constants.BLOCK_RANGE_LIMIT {
+		t.Errorf("Expected at most %d blocks, got %d", constants.BLOCK_RANGE_LIMIT, len(blocks))
+	}
+	if blocks, _ := get("/blocks?from=105"); len(blocks) != 6 || blocks[5].BlockNumber != 110 {
+		t.Errorf("Expected the blocks from 105 to the tip, got %d", len(blocks))
+	}
+	for _, target := range []string{"/blocks?from=5&to=4", "/blocks?from=x", "/blocks?from=1&to=y"} {
+		if _, code := get(target); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 but got %d", target, code)
+		}
+	}
+}
+
+func TestGetBlock(t *testing.T) {
+	bc := blockchain.NewBlockchain(blockchain.NewMemoryStore(), *blockchain.NewBlock("0x0", 0, 0), "", nil, nil)
+	b1 := blockchain.NewBlock(bc.Blocks[0].Hash(), 0, 1)
+	bc.AddBlock(b1)
+	bcs := NewBlockchainServer(0, bc)
+
+	for _, target := range []string{"/block/1", "/block/hash/" + b1.Hash()} {
+		rec := httptest.NewRecorder()
+		bcs.GetBlock(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var got blockchain.Block
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &got) != nil || got.Hash() != b1.Hash() {
+			t.Errorf("%s: expected block 1, got %d: %s", target, rec.Code, rec.Body)
+		}
+	}
+
+	for target, want := range map[string]int{
+		"/block/2":         http.StatusNotFound,
+		"/block/hash/0xab": http.StatusNotFound,
+		"/block/one":       http.StatusBadRequest,
+		"/block/hash/":     http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		bcs.GetBlock(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != want {
+			t.Errorf("%s: expected %d but got %d", target, want, rec.Code)
+		}
+	}
+}
+
+func TestGetBlocksStaysUnderByteLimit(t *testing.T) {
+	bc := blockchain.NewBlockchain(blockchain.NewMemoryStore(), *blockchain.NewBlock("0x0", 0, 0), "", nil, nil)
+	for i := 1; i <= 2; i++ {
+		b := blockchain.NewBlock(bc.Blocks[i-1].Hash(), 0, uint64(i))
+		b.Transactions = append(b.Transactions, blockchain.NewTransaction("alice", "bob", 1, make([]byte, constants.BLOCK_RANGE_MAX_BYTES/2)))
+		bc.AddBlock(b)
+	}
+	bcs := NewBlockchainServer(0, bc)
+
+	// the two blocks together are over the limit, so the caller has to ask
+	// again for the second
+	rec := httptest.NewRecorder()
+	bcs.GetBlocks(rec, httptest.NewRequest(http.MethodGet, "/blocks?from=1&to=2", nil))
+	var blocks []*blockchain.Block
+	if err := json.Unmarshal(rec.Body.Bytes(), &blocks); err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || blocks[0].BlockNumber != 1 {
+		t.Errorf("Expected only block 1 within the byte limit, got %d blocks", len(blocks))
+	}
+}
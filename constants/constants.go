@@ -2,17 +2,37 @@ package constants
 
 const (
 	BLOCKCHAIN_NAME           = "KNIRVCHAIN"
+	CHAIN_ID                  = 1
+	GENESIS_TIMESTAMP         = 1760659200000000000 // In unix nanoseconds
+	TXN_SIGNING_VERSION       = 2
 	HEX_PREFIX                = "0x"
 	SUCCESS                   = "success"
 	FAILED                    = "failed"
 	PENDING                   = "pending"
 	MINING_DIFFICULTY         = 5
+	POW_LIMIT_BITS            = 0x200fffff
+	RETARGET_INTERVAL         = 10          // In blocks
+	TARGET_BLOCK_TIME         = 10          // In seconds
+	MEDIAN_TIME_SPAN          = 11          // In blocks
+	MAX_FUTURE_BLOCK_TIME     = 2 * 60 * 60 // In seconds
 	MINING_REWARD             = 1200 * DECIMAL
 	CURRENCY_NAME             = "evo"
 	DECIMAL                   = 100
 	BLOCKCHAIN_ADDRESS        = "KNIRVCHAIN_Faucet"
 	BLOCKCHAIN_DB_PATH        = "5000/knirvdb"
 	BLOCKCHAIN_KEY            = "blockchain_key"
+	BLOCKCHAIN_HEAD_KEY       = "blockchain_head"
+	BLOCK_NUMBER_PREFIX       = "block_number_"
+	BLOCK_HASH_PREFIX         = "block_hash_"
+	TXN_POOL_KEY              = "transaction_pool"
+	MEMPOOL_JOURNAL_PREFIX    = "mempool_txn_"
+	TXN_INDEX_PREFIX          = "txn_index_"
+	ADDRESS_TXN_PREFIX        = "address_txn_"
+	ACCOUNT_PREFIX            = "account_"
+	CHAIN_WORK_PREFIX         = "chain_work_"
+	CLAMPED_DEBIT_PREFIX      = "clamped_debit_"
+	CHAIN_INDEX_VERSION_KEY   = "chain_index_version"
+	CHAIN_INDEX_VERSION       = 8
 	ADDRESS_PREFIX            = "knirvchain"
 	TXN_VERIFICATION_SUCCESS  = "verification_success"
 	TXN_VERIFICATION_FAILURE  = "verification_failure"
@@ -24,4 +44,18 @@ const (
 	CONSENSUS_PAUSE_TIME      = 5 // In seconds
 	MINING_PAUSE_TIME         = 2 // In seconds
 	TXN_PER_BLOCK_LIMIT       = 2
+	MAX_BLOCK_SIZE            = 1000000 // In bytes
+	BLOCK_RANGE_LIMIT         = 100
+	BLOCK_RANGE_MAX_BYTES     = 4000000 // In bytes
+	ADDRESS_TXNS_PAGE_LIMIT   = 20
+	ADDRESS_TXNS_MAX_LIMIT    = 100
+	FEE_ESTIMATE_BLOCKS       = 20
+	MIN_FEE_PER_BYTE          = 0
+	MEMPOOL_MAX_TXNS          = 5000
+	MEMPOOL_MAX_PER_SENDER    = 64
+	MEMPOOL_EXPIRY            = 3 * 60 * 60 // In seconds
+	MEMPOOL_MIN_BUMP_PERCENT  = 10
+	EVENT_CHANNEL_BUFFER      = 16
+	SYNC_HEADERS_LIMIT        = 500
+	SYNC_PARALLEL_FETCHES     = 4
 )
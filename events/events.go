@@ -13,3 +13,16 @@ type BlockAddedEvent struct {
 type TransactionAddedEvent struct {
 	Transaction *blockchain.Transaction
 }
+
+// ChainReorgEvent reports that the node switched to another branch. Blocks
+// from ForkNumber up were replaced: Orphaned of ours gave way to Connected
+// new ones, and Requeued transactions of the orphaned blocks went back to the
+// mempool.
+type ChainReorgEvent struct {
+	OldHead    string
+	NewHead    string
+	ForkNumber uint64
+	Orphaned   int
+	Connected  int
+	Requeued   int
+}
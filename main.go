@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 
@@ -52,6 +53,14 @@ type Config struct {
 	TxnBroadcastPauseTime  int
 	FetchLastNBlocks       int
 	ConsensusPauseTime     int
+	MaxBlockTxns           int
+	MaxBlockSize           int
+	MempoolMaxTxns         int
+	MempoolMaxPerSender    int
+	MempoolMinBumpPercent  uint64
+	RetargetInterval       uint64
+	TargetBlockTime        int
+	MiningWorkers          int
 	PeerAddresses          []string
 }
 
@@ -117,6 +126,69 @@ func loadConfig() (*Config, error) {
 	if err1 != nil {
 		return nil, fmt.Errorf("error parsing an integer config value: %w", err1)
 	}
+	// the block limits are optional and default to the constants
+	limits := blockchain.DefaultBlockLimits()
+	cfg.MaxBlockTxns = limits.MaxTxns
+	if v := os.Getenv("MAX_BLOCK_TXNS"); v != "" {
+		cfg.MaxBlockTxns, err1 = strconv.Atoi(v)
+		if err1 != nil {
+			return nil, fmt.Errorf("error parsing MAX_BLOCK_TXNS: %w", err1)
+		}
+	}
+	cfg.MaxBlockSize = limits.MaxBytes
+	if v := os.Getenv("MAX_BLOCK_SIZE"); v != "" {
+		cfg.MaxBlockSize, err1 = strconv.Atoi(v)
+		if err1 != nil {
+			return nil, fmt.Errorf("error parsing MAX_BLOCK_SIZE: %w", err1)
+		}
+	}
+	// so are the mempool caps
+	mempoolConfig := blockchain.DefaultMempoolConfig()
+	cfg.MempoolMaxTxns = mempoolConfig.MaxTxns
+	if v := os.Getenv("MEMPOOL_MAX_TXNS"); v != "" {
+		cfg.MempoolMaxTxns, err1 = strconv.Atoi(v)
+		if err1 != nil {
+			return nil, fmt.Errorf("error parsing MEMPOOL_MAX_TXNS: %w", err1)
+		}
+	}
+	cfg.MempoolMaxPerSender = mempoolConfig.MaxPerSender
+	if v := os.Getenv("MEMPOOL_MAX_PER_SENDER"); v != "" {
+		cfg.MempoolMaxPerSender, err1 = strconv.Atoi(v)
+		if err1 != nil {
+			return nil, fmt.Errorf("error parsing MEMPOOL_MAX_PER_SENDER: %w", err1)
+		}
+	}
+	cfg.MempoolMinBumpPercent = mempoolConfig.MinBumpPercent
+	if v := os.Getenv("MEMPOOL_MIN_BUMP_PERCENT"); v != "" {
+		cfg.MempoolMinBumpPercent, err1 = strconv.ParseUint(v, 10, 64)
+		if err1 != nil {
+			return nil, fmt.Errorf("error parsing MEMPOOL_MIN_BUMP_PERCENT: %w", err1)
+		}
+	}
+	// and the difficulty retarget rule
+	retarget := blockchain.DefaultRetarget()
+	cfg.RetargetInterval = retarget.Interval
+	if v := os.Getenv("RETARGET_INTERVAL"); v != "" {
+		cfg.RetargetInterval, err1 = strconv.ParseUint(v, 10, 64)
+		if err1 != nil {
+			return nil, fmt.Errorf("error parsing RETARGET_INTERVAL: %w", err1)
+		}
+	}
+	cfg.TargetBlockTime = int(retarget.BlockTime / time.Second)
+	if v := os.Getenv("TARGET_BLOCK_TIME"); v != "" {
+		cfg.TargetBlockTime, err1 = strconv.Atoi(v)
+		if err1 != nil {
+			return nil, fmt.Errorf("error parsing TARGET_BLOCK_TIME: %w", err1)
+		}
+	}
+	// and how many goroutines mine, one per core unless set
+	cfg.MiningWorkers = runtime.NumCPU()
+	if v := os.Getenv("MINING_WORKERS"); v != "" {
+		cfg.MiningWorkers, err1 = strconv.Atoi(v)
+		if err1 != nil {
+			return nil, fmt.Errorf("error parsing MINING_WORKERS: %w", err1)
+		}
+	}
 	//cfg.PeerAddresses = strings.Split(os.Getenv("PEER_ADDRESSES"), ",")
 	peerString := os.Getenv("PEER_ADDRESSES")
 	if peerString != "" {
@@ -131,6 +203,23 @@ func loadConfig() (*Config, error) {
 	return cfg, nil
 }
 
+// retarget is the difficulty retarget rule set in the configuration.
+func (cfg *Config) retarget() blockchain.Retarget {
+	return blockchain.Retarget{
+		Interval:  cfg.RetargetInterval,
+		BlockTime: time.Duration(cfg.TargetBlockTime) * time.Second,
+	}
+}
+
+// mempoolConfig is the mempool bounds set in the configuration.
+func (cfg *Config) mempoolConfig() blockchain.MempoolConfig {
+	mempoolConfig := blockchain.DefaultMempoolConfig()
+	mempoolConfig.MaxTxns = cfg.MempoolMaxTxns
+	mempoolConfig.MaxPerSender = cfg.MempoolMaxPerSender
+	mempoolConfig.MinBumpPercent = cfg.MempoolMinBumpPercent
+	return mempoolConfig
+}
+
 func init() {
 	log.SetPrefix(constants.BLOCKCHAIN_NAME + ":")
 }
@@ -184,17 +273,28 @@ func main() {
 		var consensusMgr *blockchain.ConsensusManager
 		var pm *peerManager.PeerManager
 		var blockchain1 *blockchain.BlockchainStruct
+		var syncer *blockchain.Syncer
+
+		store, err := blockchain.NewLevelDBStore(constants.BLOCKCHAIN_DB_PATH)
+		if err != nil {
+			log.Println("Error opening blockchain database:", err)
+			os.Exit(1)
+		}
 
 		blockAddedChan := make(chan events.BlockAddedEvent)
 		pm = blockchain.GetPeerManager(blockAddedChan, transactionBroadcaster.TransactionAddedChan)
 
 		if *remoteNode == "" {
-			genesisBlock := blockchain.NewBlock("0x0", 0, 0)
+			genesisBlock := blockchain.GenesisBlock()
 
 			pm.Address = "http://127.0.0.1:" + strconv.Itoa(int(*chainPort))
 
 			pm.Broadcaster = peerManager.PeerTransactionBroadcaster{PeerManager: pm}
-			blockchain1 = blockchain.NewBlockchain(*genesisBlock, pm.Address, &pm.Broadcaster, pm)
+			blockchain1 = blockchain.NewBlockchain(store, *genesisBlock, pm.Address, &pm.Broadcaster, pm)
+			blockchain1.Limits = blockchain.BlockLimits{MaxTxns: cfg.MaxBlockTxns, MaxBytes: cfg.MaxBlockSize}
+			blockchain1.Retarget = cfg.retarget()
+			blockchain1.MiningWorkers = cfg.MiningWorkers
+			blockchain1.Mempool.SetConfig(cfg.mempoolConfig())
 			blockchain1.Peers[blockchain1.Address] = true
 			bcs = blockchainserver.NewBlockchainServer(*chainPort, blockchain1)
 			consensusMgr = blockchain.NewConsensusManager(blockchain1, pm)
@@ -209,17 +309,30 @@ func main() {
 			pm.Address = "http://127.0.0.1:" + strconv.Itoa(int(*chainPort))
 			pm.Broadcaster = peerManager.PeerTransactionBroadcaster{PeerManager: pm}
 
-			//blockchain1 = blockchain.NewBlockchain(*genesisBlock, pm.Address, &pm.Broadcaster, pm)
-
-			// if *remoteNode != ""
-			remotePeerManager, err := peerManager.SyncBlockchain(*remoteNode)
-			if err != nil {
-				log.Println(err)
-			}
-
-			blockchain1 = blockchain.NewBlockchainFromSync(remotePeerManager.Blocks, pm.Address, &pm.Broadcaster, pm)
+			//blockchain1 = blockchain.NewBlockchain(store, *genesisBlock, pm.Address, &pm.Broadcaster, pm)
+
+			// start from our stored chain, or the genesis block every node
+			// shares, and sync headers first from the remote node once the
+			// server is up; a sync that was cut short resumes from the blocks
+			// we stored
+			genesisBlock := blockchain.GenesisBlock()
+			blockchain1 = blockchain.NewBlockchain(store, *genesisBlock, pm.Address, &pm.Broadcaster, pm)
+			blockchain1.Limits = blockchain.BlockLimits{MaxTxns: cfg.MaxBlockTxns, MaxBytes: cfg.MaxBlockSize}
+			blockchain1.Retarget = cfg.retarget()
+			blockchain1.MiningWorkers = cfg.MiningWorkers
+			blockchain1.Mempool.SetConfig(cfg.mempoolConfig())
 			blockchain1.Peers[blockchain1.Address] = true
 			bcs = blockchainserver.NewBlockchainServer(*chainPort, blockchain1)
+			// the remote node is asked first, then the configured peers
+			syncPeers := []string{*remoteNode}
+			for _, peer := range cfg.PeerAddresses {
+				peer = strings.TrimSpace(peer)
+				if peer != "" && peer != *remoteNode && peer != pm.Address {
+					syncPeers = append(syncPeers, peer)
+				}
+			}
+			syncer = blockchain.NewSyncer(blockchain1, syncPeers)
+			bcs.Syncer = syncer
 			consensusMgr = blockchain.NewConsensusManager(blockchain1, pm)
 
 			go func() { // This goroutine MUST start AFTER blockchain1 is initialized
@@ -235,6 +348,12 @@ func main() {
 
 		//wg.Wait() // Server is running now
 
+		if syncer != nil {
+			if err := syncer.Run(); err != nil {
+				log.Println("Error syncing blockchain:", err)
+			}
+		}
+
 		go pm.StartListening() // Start peer management AFTER server is up
 		go pm.DialAndUpdatePeers()
 
@@ -105,7 +105,7 @@ func (bcs *MockBlockchainServer) handleGetBlocks(w http.ResponseWriter) {
 
 func (bcs *MockBlockchainServer) handleGetTransactions(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json")
-	var transactions = bcs.BlockchainPtr.TransactionPool
+	var transactions = bcs.BlockchainPtr.Mempool.Transactions()
 	w.WriteHeader(http.StatusOK)
 	err := json.NewEncoder(w).Encode(transactions)
 	if err != nil {
@@ -159,7 +159,7 @@ func setupTestEnv(t *testing.T) (*Config, *httptest.Server, *consensus.Consensus
 	pm := consensus.GetPeerManager(blockAddedChan, transactionAddedChan)
 	pm.Address = "http://127.0.0.1:" + strconv.Itoa(int(cfg.Port))
 	pm.Broadcaster = peerManager.PeerTransactionBroadcaster{PeerManager: pm}
-	bc := blockchain.NewBlockchain(*genesisBlock, pm.Address, &pm.Broadcaster, pm)
+	bc := blockchain.NewBlockchain(blockchain.NewMemoryStore(), *genesisBlock, pm.Address, &pm.Broadcaster, pm)
 	bc.Peers[bc.Address] = true
 	mockServer := httptest.NewServer(NewMockBlockchainServer(bc))
 
@@ -0,0 +1,117 @@
+// Package merkle builds the Merkle trees blocks commit to their
+// transactions with.
+//
+// Leaves and inner nodes are hashed with different prefixes, so a leaf can
+// never pass for a node:
+//
+//	leaf  sha256(0x00 || data)
+//	node  sha256(0x01 || left || right)
+//
+// Each level pairs its nodes from the left; a node left over at the end of
+// a level is promoted to the next one as it is, rather than paired with a
+// copy of itself. The root of no leaves is sha256 of nothing.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// LeafHash is the hash of the leaf holding data.
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// NodeHash is the hash of the inner node over left and right.
+func NodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Root is the root of the tree over leaves, given as the data they hold.
+func Root(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	}
+
+	level := leafLevel(leaves)
+	for len(level) > 1 {
+		level = nextLevel(level)
+	}
+	return level[0]
+}
+
+// leafLevel is the bottom level of the tree over leaves.
+func leafLevel(leaves [][]byte) [][]byte {
+	level := make([][]byte, len(leaves))
+	for i, data := range leaves {
+		level[i] = LeafHash(data)
+	}
+	return level
+}
+
+// nextLevel pairs the nodes of level into the level above it.
+func nextLevel(level [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i])
+			continue
+		}
+		next = append(next, NodeHash(level[i], level[i+1]))
+	}
+	return next
+}
+
+// Step is one node on the path from a leaf up to the root: the sibling to
+// hash with, and whether it sits on the left. Levels where the node on the
+// path is promoted have no step.
+type Step struct {
+	Hash []byte
+	Left bool
+}
+
+// Proof returns the steps from the leaf at index up to the root of the tree
+// over leaves.
+func Proof(leaves [][]byte, index int) ([]Step, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("no leaf %d among %d leaves", index, len(leaves))
+	}
+
+	level := leafLevel(leaves)
+	var steps []Step
+	for len(level) > 1 {
+		if sibling := index ^ 1; sibling < len(level) {
+			steps = append(steps, Step{Hash: level[sibling], Left: sibling < index})
+		}
+		level = nextLevel(level)
+		index /= 2
+	}
+	return steps, nil
+}
+
+// Verify reports whether the leaf holding data leads up to root by steps.
+func Verify(root, data []byte, steps []Step) bool {
+	hash := LeafHash(data)
+	for _, step := range steps {
+		if step.Left {
+			hash = NodeHash(step.Hash, hash)
+		} else {
+			hash = NodeHash(hash, step.Hash)
+		}
+	}
+	return bytes.Equal(hash, root)
+}
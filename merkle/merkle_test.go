@@ -0,0 +1,76 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestRoot(t *testing.T) {
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+
+	empty := sha256.Sum256(nil)
+	if root := Root(nil); !bytes.Equal(root, empty[:]) {
+		t.Errorf("Expected the root of no leaves to be sha256 of nothing, got %x", root)
+	}
+	if root := Root([][]byte{a}); !bytes.Equal(root, LeafHash(a)) {
+		t.Errorf("Expected the root of one leaf to be its hash, got %x", root)
+	}
+
+	ab := NodeHash(LeafHash(a), LeafHash(b))
+	if root := Root([][]byte{a, b}); !bytes.Equal(root, ab) {
+		t.Errorf("Expected the root of two leaves to be the node over them, got %x", root)
+	}
+
+	// c has no partner and is promoted as it is
+	abc := NodeHash(ab, LeafHash(c))
+	if root := Root([][]byte{a, b, c}); !bytes.Equal(root, abc) {
+		t.Errorf("Expected the odd leaf to be promoted, got %x", root)
+	}
+	if root := Root([][]byte{a, b, c, c}); bytes.Equal(root, abc) {
+		t.Error("Expected a repeated last leaf to change the root")
+	}
+	if root := Root([][]byte{b, a}); bytes.Equal(root, ab) {
+		t.Error("Expected the order of the leaves to change the root")
+	}
+}
+
+func TestLeafIsNotANode(t *testing.T) {
+	left, right := LeafHash([]byte("a")), LeafHash([]byte("b"))
+	if bytes.Equal(LeafHash(append(left, right...)), NodeHash(left, right)) {
+		t.Error("Expected a leaf over two hashes to differ from the node over them")
+	}
+}
+
+func TestProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		leaves := make([][]byte, n)
+		for i := range leaves {
+			leaves[i] = []byte{byte(i)}
+		}
+		root := Root(leaves)
+
+		for i := range leaves {
+			steps, err := Proof(leaves, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !Verify(root, leaves[i], steps) {
+				t.Errorf("Expected leaf %d of %d to verify", i, n)
+			}
+			if Verify(root, []byte{byte(n)}, steps) {
+				t.Errorf("Expected other data to fail the proof of leaf %d of %d", i, n)
+			}
+			if len(steps) > 0 {
+				steps[0].Left = !steps[0].Left
+				if Verify(root, leaves[i], steps) {
+					t.Errorf("Expected a proof with a flipped step to fail for leaf %d of %d", i, n)
+				}
+			}
+		}
+	}
+
+	if _, err := Proof([][]byte{{0}}, 1); err == nil {
+		t.Error("Expected a proof of a missing leaf to fail")
+	}
+}
@@ -0,0 +1,125 @@
+// Package txnproof checks that a transaction succeeded in a block from the
+// block header and a Merkle branch alone. It needs nothing of the node
+// beyond the merkle package, so a light client can verify the proofs a node
+// serves without pulling in the chain, its store or its peers.
+package txnproof
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"KNIRVCHAIN-MAIN/constants"
+	"KNIRVCHAIN-MAIN/merkle"
+)
+
+// ErrNoMerkleRoot is returned for a block whose header commits to no
+// transactions, which nothing short of the whole block proves.
+var ErrNoMerkleRoot = errors.New("block has no merkle root")
+
+// BlockHeader is a block header as it is hashed and mined. It marshals
+// exactly like blockchain.BlockHeader, which converts to it.
+type BlockHeader struct {
+	BlockNumber uint64 `json:"block_number"`
+	PrevHash    string `json:"prevHash"`
+	MerkleRoot  string `json:"merkle_root,omitempty"`
+	Timestamp   int64  `json:"timestamp"`
+	Nonce       int    `json:"nonce"`
+	Bits        uint32 `json:"bits,omitempty"`
+}
+
+// Header is a block header and the hash it claims.
+type Header struct {
+	BlockHeader
+	Hash string `json:"hash"`
+}
+
+// Step is a merkle.Step with its hash in 0x prefixed hex.
+type Step struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"`
+}
+
+// Proof is the branch from a transaction up to the Merkle root of the
+// header of its block.
+type Proof struct {
+	Index         int    `json:"index"`
+	Branch        []Step `json:"branch"`
+	Header        Header `json:"header"`
+	Confirmations uint64 `json:"confirmations"`
+}
+
+// Verify checks that p proves the transaction with hash succeeded in the
+// block of its header, and that the header meets its proof of work at a
+// target no easier than the limit. That much a peer can forge by mining one
+// header at the limit, so it does not show the block is on the best chain:
+// the caller has to check Header.Hash against the hash of block
+// Header.BlockNumber in headers it trusts, or else trust whoever served the
+// proof.
+func (p *Proof) Verify(hash string) error {
+	h := p.Header
+	if h.MerkleRoot == "" {
+		return ErrNoMerkleRoot
+	}
+	if got := h.hash(); got != h.Hash {
+		return fmt.Errorf("header hashes to %s, not %s", got, h.Hash)
+	}
+	target := compactToTarget(h.Bits)
+	if h.Bits == 0 || target.Cmp(compactToTarget(constants.POW_LIMIT_BITS)) > 0 {
+		return fmt.Errorf("header target bits %08x are easier than the limit", h.Bits)
+	}
+	if value, ok := new(big.Int).SetString(strings.TrimPrefix(h.Hash, constants.HEX_PREFIX), 16); !ok || value.Cmp(target) > 0 {
+		return fmt.Errorf("header hash %s does not meet the proof of work", h.Hash)
+	}
+
+	root, err := decodeHash(h.MerkleRoot)
+	if err != nil {
+		return fmt.Errorf("merkle root: %w", err)
+	}
+	txnHash, err := decodeHash(hash)
+	if err != nil {
+		return fmt.Errorf("transaction hash: %w", err)
+	}
+	steps := make([]merkle.Step, len(p.Branch))
+	for i, step := range p.Branch {
+		sibling, err := decodeHash(step.Hash)
+		if err != nil {
+			return fmt.Errorf("branch step %d: %w", i, err)
+		}
+		steps[i] = merkle.Step{Hash: sibling, Left: step.Left}
+	}
+	// the leaf of a transaction is its hash followed by the status the
+	// block settled on, so a failed transaction has another leaf
+	leaf := append(txnHash, constants.SUCCESS...)
+	if !merkle.Verify(root, leaf, steps) {
+		return fmt.Errorf("branch does not lead from successful transaction %s to merkle root %s", hash, h.MerkleRoot)
+	}
+	return nil
+}
+
+// hash is the hash of the header, computed as blockchain.Block.Hash does
+// for a block with a Merkle root.
+func (h Header) hash() string {
+	bs, _ := json.Marshal(h.BlockHeader)
+	sum := sha256.Sum256(bs)
+	return constants.HEX_PREFIX + hex.EncodeToString(sum[:])
+}
+
+// compactToTarget expands compact bits into the target they stand for, as
+// blockchain.CompactToTarget does.
+func compactToTarget(bits uint32) *big.Int {
+	size := uint(bits >> 24)
+	target := big.NewInt(int64(bits & 0x007fffff))
+	if size <= 3 {
+		return target.Rsh(target, 8*(3-size))
+	}
+	return target.Lsh(target, 8*(size-3))
+}
+
+func decodeHash(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, constants.HEX_PREFIX))
+}
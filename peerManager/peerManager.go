@@ -76,12 +76,22 @@ type ClientPeer struct {
 	ID          string `json:"id"`
 }
 
+// RemoteBlockHeader is the header of a block as a peer sent it.
+type RemoteBlockHeader struct {
+	BlockNumber uint64 `json:"block_number"`
+	PrevHash    string `json:"prevHash"`
+	MerkleRoot  string `json:"merkle_root,omitempty"`
+	Timestamp   int64  `json:"timestamp"`
+	Nonce       int    `json:"nonce"`
+	Bits        uint32 `json:"bits,omitempty"`
+}
+
+// RemoteBlock is a block as a peer sent it. The transactions are kept as
+// the raw JSON they arrived in, so RemoteHash is the hash the peer mined and
+// the blockchain package can decode them without losing a field.
 type RemoteBlock struct {
-	BlockNumber  uint64                     `json:"block_number"`
-	PrevHash     string                     `json:"prevHash"`
-	Timestamp    int64                      `json:"timestamp"`
-	Nonce        int                        `json:"nonce"`
-	Transactions []*transaction.Transaction `json:"transactions"`
+	RemoteBlockHeader
+	Transactions json.RawMessage `json:"transactions"`
 }
 
 func (pm *PeerManager) StartListening() { // New function to listen for events
@@ -103,14 +113,24 @@ func (pm *PeerManager) StartListening() { // New function to listen for events
 }
 
 func (pm *PeerManager) processBlockAdded(block *block.Block) {
+	txns, err := json.Marshal(block.Transactions)
+	if err != nil {
+		log.Println("Error encoding transactions of block", block.BlockNumber, err)
+		return
+	}
+
 	pm.Mutex.Lock()
 	defer pm.Mutex.Unlock()
 	pm.Blocks = append(pm.Blocks, &RemoteBlock{
-		BlockNumber:  block.BlockNumber,
-		PrevHash:     block.PrevHash,
-		Timestamp:    block.Timestamp,
-		Nonce:        block.Nonce,
-		Transactions: block.Transactions,
+		RemoteBlockHeader: RemoteBlockHeader{
+			BlockNumber: block.BlockNumber,
+			PrevHash:    block.PrevHash,
+			MerkleRoot:  block.MerkleRoot,
+			Timestamp:   block.Timestamp,
+			Nonce:       block.Nonce,
+			Bits:        block.Bits,
+		},
+		Transactions: txns,
 	})
 
 }
@@ -213,6 +233,10 @@ func (pm *PeerManager) UpdatePeer(peer Peer) {
 
 }
 
+// SyncBlockchain downloads the whole chain of the node at address in one
+// response.
+//
+// Deprecated: nodes sync headers first with blockchain.Syncer.
 func SyncBlockchain(address string) (*PeerManager, error) {
 	log.Println("Started syncing blockchain from node:", address)
 	ourURL := fmt.Sprintf("%s/", address)
@@ -375,35 +399,22 @@ func FetchLastNBlocks(address string) (*PeerManager, error) {
 
 	return &nbc, nil
 }
-func (rb RemoteBlock) RemoteHash() string {
 
-	bs, _ := json.Marshal(rb)
+// RemoteHash is the hash of the block header, or of the whole block for a
+// block from before Merkle roots, like the blockchain package's Block.Hash.
+func (rb RemoteBlock) RemoteHash() string {
+	var bs []byte
+	if rb.MerkleRoot != "" {
+		bs, _ = json.Marshal(rb.RemoteBlockHeader)
+	} else {
+		bs, _ = json.Marshal(rb)
+	}
 	sum := sha256.Sum256(bs)
 	hexRep := hex.EncodeToString(sum[:32])
 	formattedHexRep := constants.HEX_PREFIX + hexRep
 
 	return formattedHexRep
 }
-func (pm *PeerManager) VerifyLastNBlocks(blocks []*RemoteBlock) bool {
-	if blocks[0].BlockNumber != 0 && blocks[0].RemoteHash()[2:2+constants.MINING_DIFFICULTY] != strings.Repeat("0", constants.MINING_DIFFICULTY) {
-		log.Println("Chain verification failed for block", blocks[0].BlockNumber, "hash", blocks[0].RemoteHash())
-		return false
-	}
-
-	for i := 1; i < len(blocks); i++ {
-		if blocks[i-1].RemoteHash() != blocks[i].PrevHash {
-			log.Println("Failed to verify prevHash for block number", blocks[i].BlockNumber)
-			return false
-		}
-
-		if blocks[i].RemoteHash()[2:2+constants.MINING_DIFFICULTY] != strings.Repeat("0", constants.MINING_DIFFICULTY) {
-			log.Println("Chain verification failed for block", blocks[0].BlockNumber, "hash", blocks[0].RemoteHash())
-			return false
-		}
-	}
-
-	return true
-}
 
 func (pm *PeerManager) HandleRequest(w http.ResponseWriter, req *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
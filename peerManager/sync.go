@@ -0,0 +1,73 @@
+package peerManager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// RemoteHeader is what a peer sends for a block during headers-first sync:
+// the block header and the hash of the block. The body fetched later has to
+// hash to the same value.
+type RemoteHeader struct {
+	RemoteBlockHeader
+	Hash string `json:"hash"`
+}
+
+// FetchHeaders asks the peer at address for the headers of up to count
+// blocks starting at block number from.
+func FetchHeaders(address string, from uint64, count int) ([]*RemoteHeader, error) {
+	query := url.Values{}
+	query.Set("from", strconv.FormatUint(from, 10))
+	query.Set("count", strconv.Itoa(count))
+
+	var headers []*RemoteHeader
+	if err := fetchRange(address, "headers", query, &headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// FetchBlocks asks the peer at address for the whole blocks numbered from to
+// to, both included. The peer may send fewer, starting at from, to stay
+// within its limits.
+func FetchBlocks(address string, from, to uint64) ([]*RemoteBlock, error) {
+	query := url.Values{}
+	query.Set("from", strconv.FormatUint(from, 10))
+	query.Set("to", strconv.FormatUint(to, 10))
+
+	var blocks []*RemoteBlock
+	if err := fetchRange(address, "blocks", query, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+func fetchRange(address, endpoint string, query url.Values, v interface{}) error {
+	u, err := url.Parse(strings.TrimSpace(address))
+	if err != nil {
+		return fmt.Errorf("invalid peer address: %w", err)
+	}
+	u.Path = path.Join(u.Path, endpoint)
+	u.RawQuery = query.Encode()
+
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s from %s: %s", endpoint, address, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, v)
+}
@@ -4,13 +4,10 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
-	"encoding/json"
 	"fmt"
 	"math/big"
 
-	"KNIRVCHAIN-MAIN/constants"
-	"KNIRVCHAIN-MAIN/transaction"
+	"KNIRVCHAIN-MAIN/blockchain"
 )
 
 type Wallet struct {
@@ -53,30 +50,33 @@ func (w *Wallet) GetPrivateKeyHex() string {
 }
 
 func (w *Wallet) GetPublicKeyHex() string {
-	return fmt.Sprintf("0x%x%x", w.PublicKey.X, w.PublicKey.Y)
+	return fmt.Sprintf("0x%064x%064x", w.PublicKey.X, w.PublicKey.Y)
 }
 
 func (w *Wallet) GetAddress() string {
-	hash := sha256.Sum256([]byte(w.GetPublicKeyHex()[2:]))
-	hex := fmt.Sprintf("%x", hash[:])
-	address := constants.ADDRESS_PREFIX + hex[len(hex)-40:]
-	return address
+	return blockchain.GetAddressFromPublicKeyHex(w.GetPublicKeyHex())
 }
 
-func (w *Wallet) GetSignedTxn(unsignedTxn transaction.Transaction) (*transaction.Transaction, error) {
-	bs, err := json.Marshal(unsignedTxn)
-	if err != nil {
-		return nil, err
-	}
-	hash := sha256.Sum256(bs)
+// GetLegacyAddress returns the address older versions derived from the
+// public key, with X and Y written without leading zeros. It differs from
+// GetAddress for about one key in eight; a transaction signed by this wallet
+// may still spend from it.
+func (w *Wallet) GetLegacyAddress() string {
+	return blockchain.GetLegacyAddressFromPublicKeyHex(w.GetPublicKeyHex())
+}
+
+// GetSignedTxn signs the SigningPayload of unsignedTxn and returns a copy of
+// it carrying the signature and our public key.
+func (w *Wallet) GetSignedTxn(unsignedTxn blockchain.Transaction) (*blockchain.Transaction, error) {
+	hash := unsignedTxn.SigningHash()
 
 	sig, err := ecdsa.SignASN1(rand.Reader, w.PrivateKey, hash[:])
 	if err != nil {
 		return nil, err
 	}
-	signedTxn := transaction.NewTransaction(unsignedTxn.From, unsignedTxn.To, unsignedTxn.Value, unsignedTxn.Data)
+	signedTxn := unsignedTxn
 	signedTxn.Signature = sig
 	signedTxn.PublicKey = w.GetPublicKeyHex()
 
-	return signedTxn, nil
+	return &signedTxn, nil
 }
@@ -0,0 +1,43 @@
+package wallet
+
+import (
+	"fmt"
+	"testing"
+
+	"KNIRVCHAIN-MAIN/blockchain"
+)
+
+func TestGetAddressFormats(t *testing.T) {
+	var short, full *Wallet
+	for i := 0; i < 1000 && (short == nil || full == nil); i++ {
+		w, err := NewWallet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.PublicKey.X.BitLen() <= 252 || w.PublicKey.Y.BitLen() <= 252 {
+			short = w
+		} else {
+			full = w
+		}
+	}
+	if short == nil || full == nil {
+		t.Fatal("Expected to find keys with and without leading zeros")
+	}
+
+	for _, w := range []*Wallet{short, full} {
+		if len(w.GetPublicKeyHex()) != 2+128 {
+			t.Errorf("Expected a full width public key but got %s", w.GetPublicKeyHex())
+		}
+		// the address older versions derived from the unpadded key
+		legacy := blockchain.GetAddressFromPublicKeyHex(fmt.Sprintf("%x%x", w.PublicKey.X, w.PublicKey.Y))
+		if got := w.GetLegacyAddress(); got != legacy {
+			t.Errorf("Expected legacy address %s but got %s", legacy, got)
+		}
+	}
+	if full.GetLegacyAddress() != full.GetAddress() {
+		t.Error("Expected a key without leading zeros to keep its address")
+	}
+	if short.GetLegacyAddress() == short.GetAddress() {
+		t.Error("Expected a key with leading zeros to have had another address")
+	}
+}
@@ -7,8 +7,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strings"
 
-	"KNIRVCHAIN-MAIN/transaction"
+	"KNIRVCHAIN-MAIN/blockchain"
 )
 
 type WalletServer struct {
@@ -22,6 +23,9 @@ type TransactionRequest struct {
 	FromAddress string `json:"from_address"`
 	ToAddress   string `json:"to_address"`
 	Value       uint64 `json:"value"`
+	Fee         uint64 `json:"fee"`
+	Nonce       uint64 `json:"nonce"`
+	Timestamp   int64  `json:"timestamp"`
 	PrivateKey  string `json:"private_key"`
 	PublicKey   string `json:"public_key"`
 	Signature   []byte `json:"signature"`
@@ -39,6 +43,8 @@ func (ws *WalletServer) Start() func() {
 
 	http.HandleFunc("/transactions", ws.handlePostTransaction)
 	http.HandleFunc("/send_signed_txn", ws.handleSendSignedTransaction)
+	http.HandleFunc("/address/", ws.handleGetAddressTxns)
+	http.HandleFunc("/tx/", ws.handleGetTxnProof)
 
 	go func() {
 		if err := ws.Server.ListenAndServe(); err != http.ErrServerClosed {
@@ -71,6 +77,75 @@ func (ws *WalletServer) handleSendSignedTransaction(w http.ResponseWriter, r *ht
 
 }
 
+// handleGetAddressTxns passes GET /address/{address}/txns, with its paging
+// parameters, through to the blockchain node.
+func (ws *WalletServer) handleGetAddressTxns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	nodeURL := fmt.Sprintf("%s%s", ws.blockchainNode, r.URL.Path)
+	if r.URL.RawQuery != "" {
+		nodeURL += "?" + r.URL.RawQuery
+	}
+	resp, err := http.Get(nodeURL)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch address history from blockchain: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// handleGetTxnProof fetches GET /tx/{hash}/proof from the blockchain node
+// and passes the proof on only once it verifies: the transaction succeeded
+// in the block the header commits to, and the header meets a target no
+// easier than the limit. That the block is on the best chain is still the node's word,
+// as the wallet server keeps no headers of its own.
+func (ws *WalletServer) handleGetTxnProof(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	hash := strings.TrimPrefix(r.URL.Path, "/tx/")
+	if !strings.HasSuffix(hash, "/proof") {
+		http.NotFound(w, r)
+		return
+	}
+	hash = strings.TrimSuffix(hash, "/proof")
+
+	resp, err := http.Get(fmt.Sprintf("%s/tx/%s/proof", ws.blockchainNode, hash))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch transaction proof from blockchain: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	var proof blockchain.TxnProof
+	if err := json.NewDecoder(resp.Body).Decode(&proof); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to decode transaction proof: %v", err), http.StatusBadGateway)
+		return
+	}
+	if err := proof.Verify(hash); err != nil {
+		http.Error(w, fmt.Sprintf("Transaction proof does not verify: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(proof)
+}
+
 func (ws *WalletServer) handlePostTransactionPost(w http.ResponseWriter, r *http.Request) {
 	var transactionRequest TransactionRequest
 	if r.Body == nil {
@@ -83,7 +158,9 @@ func (ws *WalletServer) handlePostTransactionPost(w http.ResponseWriter, r *http
 		return
 	}
 	// Create the new transaction
-	txn := transaction.NewTransaction(transactionRequest.FromAddress, transactionRequest.ToAddress, transactionRequest.Value, []byte{})
+	txn := blockchain.NewTransaction(transactionRequest.FromAddress, transactionRequest.ToAddress, transactionRequest.Value, []byte{})
+	txn.Fee = transactionRequest.Fee
+	txn.Nonce = transactionRequest.Nonce
 
 	// Send the new transaction to the blockchain
 	blockchainAddress := fmt.Sprintf("%s/transactions", ws.blockchainNode)
@@ -124,7 +201,10 @@ func (ws *WalletServer) handleSendSignedTransactionPost(w http.ResponseWriter, r
 	}
 
 	// Create the new transaction
-	txn := transaction.NewTransaction(transactionRequest.FromAddress, transactionRequest.ToAddress, transactionRequest.Value, []byte{})
+	txn := blockchain.NewTransaction(transactionRequest.FromAddress, transactionRequest.ToAddress, transactionRequest.Value, []byte{})
+	txn.Fee = transactionRequest.Fee
+	txn.Nonce = transactionRequest.Nonce
+	txn.Timestamp = transactionRequest.Timestamp // the timestamp is part of the signed payload
 	txn.Signature = transactionRequest.Signature // set the signature
 	txn.PublicKey = transactionRequest.PublicKey // set the public key
 